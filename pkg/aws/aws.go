@@ -1,98 +1,79 @@
 package aws
 
 import (
-	"bytes"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
-	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/role"
 	"go.uber.org/zap"
-	ini "gopkg.in/ini.v1"
-)
-
-const (
-	defaultProfileSectionName = "default"
 )
 
 // AWS ...
 type AWS struct {
-	IAM  iamiface.IAMAPI
-	STS  stsiface.STSAPI
-	sess *session.Session
+	IAM            iamiface.IAMAPI
+	STS            stsiface.STSAPI
+	sess           *session.Session
+	sessionTags    map[string]string
+	sourceIdentity bool
 }
 
 // New ...
-func New(sess *session.Session) *AWS {
+func New(sess *session.Session, setOpts ...Option) *AWS {
+	opts := defaultOptions()
+
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
 	iamSvc := iam.New(sess)
 	stsSvc := sts.New(sess)
 
 	return &AWS{
-		IAM:  iamSvc,
-		STS:  stsSvc,
-		sess: sess,
+		IAM:            iamSvc,
+		STS:            stsSvc,
+		sess:           sess,
+		sessionTags:    opts.SessionTags,
+		sourceIdentity: opts.SourceIdentity,
 	}
 }
 
-// CredentialLocation returns the location the AWS credentials will be stored in.
-// Defaults to ~/.aws/credentials
-func (a *AWS) CredentialLocation() (string, error) {
-	userHome, err := file.WithUserHomeDir(".aws", "credentials")
-	if err != nil {
-		return "", err
-	}
-
-	return userHome, nil
-}
-
 // GetRegion gets the region associated with the calling credentials
 func (a *AWS) GetRegion() string {
-	return *a.sess.Config.Region
+	return aws.StringValue(a.sess.Config.Region)
 }
 
-// GetCredential takes in a role ID and returns a set of wrapped credentials, or an error
-func (a *AWS) GetCredential(roleID string) (*role.Credential, error) {
-	roleCreds, err := a.AssumeRole(roleID)
+// GetCredential takes in a role request and returns a set of wrapped credentials, or an error
+func (a *AWS) GetCredential(req *role.Request) (*role.Credential, error) {
+	out, err := a.AssumeRole(req)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Extract this from this function
-	// Create an empty credential file
-	credFile := ini.Empty()
-
-	// Seed the role creds
-	defaultSection, err := credFile.NewSection(defaultProfileSectionName)
-	if err != nil {
-		logging.Logger().Error("error creating section", zap.Error(err))
-		return nil, err
+	cred := &role.Credential{
+		AccessKeyID:     aws.StringValue(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(out.Credentials.SessionToken),
+		Expiration:      aws.TimeValue(out.Credentials.Expiration),
+		Region:          a.GetRegion(),
+		RoleARN:         req.RoleARN,
 	}
 
-	defaultSection.NewKey("aws_access_key_id", *roleCreds.AccessKeyId)
-	defaultSection.NewKey("aws_secret_access_key", *roleCreds.SecretAccessKey)
-	defaultSection.NewKey("aws_session_token", *roleCreds.SessionToken)
-	defaultSection.NewKey("region", a.GetRegion())
-
-	var b bytes.Buffer
-
-	if _, err := credFile.WriteTo(&b); err != nil {
-		return nil, err
+	if out.AssumedRoleUser != nil {
+		cred.RoleARN = aws.StringValue(out.AssumedRoleUser.Arn)
 	}
 
-	credLocation, err := a.CredentialLocation()
-	if err != nil {
-		return nil, err
+	if parsed, err := arn.Parse(cred.RoleARN); err == nil {
+		cred.AccountID = parsed.AccountID
 	}
 
-	return &role.Credential{
-		Raw:      b.Bytes(),
-		Location: credLocation,
-	}, nil
+	return cred, nil
 }
 
 // GetRoleARN gets the role ARN from a role name
@@ -109,13 +90,20 @@ func (a *AWS) GetRoleARN(role string) (string, error) {
 	return *out.Role.Arn, nil
 }
 
-// AssumeRole will assume a role from the name
-func (a *AWS) AssumeRole(role string) (*sts.Credentials, error) {
-	// TODO: Need to be able to override duration
+// AssumeRole will assume the requested role. The session is named after the
+// user so it can be traced back to them in CloudTrail. A zero duration uses
+// the STS default.
+func (a *AWS) AssumeRole(req *role.Request) (*sts.AssumeRoleOutput, error) {
 	input := sts.AssumeRoleInput{
-		RoleArn: aws.String(role),
-		// TODO: Pass in email
-		RoleSessionName: aws.String("default"),
+		RoleArn:         aws.String(req.RoleARN),
+		RoleSessionName: aws.String(sessionName(req.Email)),
+		Tags:            sessionTags(a.sessionTags, req.Attributes),
+	}
+	if req.Duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(req.Duration / time.Second))
+	}
+	if a.sourceIdentity {
+		input.SourceIdentity = aws.String(sessionName(req.Email))
 	}
 	out, err := a.STS.AssumeRole(&input)
 	if err != nil {
@@ -123,5 +111,5 @@ func (a *AWS) AssumeRole(role string) (*sts.Credentials, error) {
 		return nil, err
 	}
 
-	return out.Credentials, nil
+	return out, nil
 }
@@ -0,0 +1,33 @@
+package aws
+
+// Options contains all AWS options
+type Options struct {
+	// Session tags to attach to assumed roles, mapping the tag key to the
+	// directory attribute its value comes from
+	SessionTags map[string]string
+	// Whether to set the user's email as the source identity of the session
+	SourceIdentity bool
+}
+
+// Option is a functional way of setting options for AWS
+type Option func(o *Options)
+
+// WithSessionTags sets the session tags on the Options struct
+func WithSessionTags(tags map[string]string) Option {
+	return func(o *Options) {
+		o.SessionTags = tags
+	}
+}
+
+// WithSourceIdentity sets whether to set the source identity on the Options struct
+func WithSourceIdentity(enabled bool) Option {
+	return func(o *Options) {
+		o.SourceIdentity = enabled
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		SessionTags: map[string]string{},
+	}
+}
@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	// Limits STS puts on session names and source identities
+	minSessionNameLength = 2
+	maxSessionNameLength = 64
+	// Limits STS puts on session tags
+	maxSessionTags        = 50
+	maxSessionTagValueLen = 256
+)
+
+var (
+	invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+	invalidTagValueChars    = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+)
+
+// sessionName turns the email into something STS accepts as a session name
+// or source identity
+func sessionName(email string) string {
+	name := invalidSessionNameChars.ReplaceAllString(email, "-")
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+
+	// Shouldn't happen with a real email, but STS won't take it
+	for len(name) < minSessionNameLength {
+		name += "-"
+	}
+
+	return name
+}
+
+// sessionTags builds session tags from the user's directory attributes.
+// Attributes the user doesn't have are left off.
+func sessionTags(tagAttributes map[string]string, attributes map[string]string) []*sts.Tag {
+	keys := []string{}
+	for key := range tagAttributes {
+		keys = append(keys, key)
+	}
+	// Keep the order stable so it's predictable which tags get dropped
+	sort.Strings(keys)
+
+	tags := []*sts.Tag{}
+	for _, key := range keys {
+		value := invalidTagValueChars.ReplaceAllString(attributes[tagAttributes[key]], "_")
+		if value == "" {
+			continue
+		}
+		if runes := []rune(value); len(runes) > maxSessionTagValueLen {
+			value = string(runes[:maxSessionTagValueLen])
+		}
+
+		if len(tags) == maxSessionTags {
+			break
+		}
+
+		tags = append(tags, &sts.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
@@ -0,0 +1,74 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestSessionName(t *testing.T) {
+	testCases := []struct {
+		email    string
+		expected string
+	}{
+		{
+			email:    "jane.doe+aws@example.com",
+			expected: "jane.doe+aws@example.com",
+		},
+		// Characters STS doesn't allow are replaced
+		{
+			email:    "jane doe!@example.com",
+			expected: "jane-doe-@example.com",
+		},
+		// Names are capped at 64 characters
+		{
+			email:    strings.Repeat("a", 70) + "@example.com",
+			expected: strings.Repeat("a", 64),
+		},
+		// And need at least 2
+		{
+			email:    "",
+			expected: "--",
+		},
+	}
+
+	for i, testCase := range testCases {
+		if out := sessionName(testCase.email); out != testCase.expected {
+			t.Errorf("[%d] - Expected %s, got %s\n", i, testCase.expected, out)
+		}
+	}
+}
+
+func TestSessionTags(t *testing.T) {
+	tagAttributes := map[string]string{
+		"Department": "department",
+		"CostCenter": "cost_center",
+		"OU":         "org_unit_path",
+	}
+	attributes := map[string]string{
+		"department":    "Platform & Infra",
+		"org_unit_path": "/Engineering/Platform",
+	}
+
+	tags := sessionTags(tagAttributes, attributes)
+
+	expected := map[string]string{
+		"Department": "Platform _ Infra",
+		"OU":         "/Engineering/Platform",
+	}
+
+	if len(tags) != len(expected) {
+		t.Fatalf("Expected %d tags, got %d\n", len(expected), len(tags))
+	}
+
+	for _, tag := range tags {
+		if expected[aws.StringValue(tag.Key)] != aws.StringValue(tag.Value) {
+			t.Errorf("Expected %s=%s, got %s\n", aws.StringValue(tag.Key), expected[aws.StringValue(tag.Key)], aws.StringValue(tag.Value))
+		}
+	}
+
+	if tags := sessionTags(map[string]string{}, attributes); tags != nil {
+		t.Errorf("Expected no tags, got %v\n", tags)
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+const (
+	credentialsPath = "/credentials"
+	rolesPath       = "/roles"
+	providerPath    = "/auth/provider"
+	sessionsPath    = "/auth/sessions"
+	loginPath       = "/auth/login"
+)
+
+// hints tell the user what to do about refusals they can do something about
+var hints = map[string]string{
+	handlers.ErrorCodeUserSuspended:   "ask your administrator to restore your account",
+	handlers.ErrorCodeUserArchived:    "ask your administrator to restore your account",
+	handlers.ErrorCodeUser2SVRequired: "turn on 2-Step Verification at https://myaccount.google.com/signinoptions/two-step-verification, then log in again",
+}
+
+// Error is returned when the server refuses a request
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server returned %d", e.Status)
+	}
+	if hint, ok := hints[e.Code]; ok {
+		return fmt.Sprintf("server returned %d (%s): %s - %s", e.Status, e.Code, e.Message, hint)
+	}
+	return fmt.Sprintf("server returned %d (%s): %s", e.Status, e.Code, e.Message)
+}
+
+// Client talks to the login server
+type Client struct {
+	baseURL string
+	idToken string
+	client  *http.Client
+}
+
+// New creates a Client for the server that identifies the caller with the ID
+// token. For backwards compatibility with older configs, the server can also
+// be given as the URL of its credentials endpoint.
+func New(server, idToken string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(strings.TrimSuffix(server, "/"), credentialsPath),
+		idToken: idToken,
+		client:  &http.Client{},
+	}
+}
+
+// Credentials requests a set of credentials for a role
+func (c *Client) Credentials(req *handlers.CredentialHandlerRequest) (*handlers.CredentialHandlerResponse, error) {
+	resp := &handlers.CredentialHandlerResponse{}
+	if err := c.post(credentialsPath, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Roles lists the roles the user is entitled to
+func (c *Client) Roles(req *handlers.CredentialHandlerRequest) (*handlers.RolesHandlerResponse, error) {
+	resp := &handlers.RolesHandlerResponse{}
+	if err := c.post(rolesPath, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Provider gets what's needed to log into the identity provider without
+// going through the server. Doesn't need an ID token.
+func (c *Client) Provider() (*handlers.ProviderResponse, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, c.baseURL+providerPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &handlers.ProviderResponse{}
+	if err := c.do(httpReq, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StartSession starts a browser login for the credentials in the request.
+// Doesn't need an ID token, the user logs in at LoginURL instead.
+func (c *Client) StartSession(req *handlers.CredentialHandlerRequest) (*handlers.SessionResponse, error) {
+	resp := &handlers.SessionResponse{}
+	if err := c.post(sessionsPath, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// LoginURL is where the user logs in for the session
+func (c *Client) LoginURL(sessionID string) string {
+	return c.baseURL + loginPath + "?session=" + url.QueryEscape(sessionID)
+}
+
+// PickupCredentials waits a little while for the session's login to finish,
+// returning the credentials if it has. A nil response with no error means
+// it's still waiting on the user.
+func (c *Client) PickupCredentials(sessionID, secret string) (*handlers.CredentialHandlerResponse, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, c.baseURL+sessionsPath+"/"+url.PathEscape(sessionID)+"/credentials", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+secret)
+
+	resp := &handlers.CredentialHandlerResponse{}
+	status, err := c.send(httpReq, resp)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusAccepted {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+func (c *Client) post(path string, req interface{}, resp interface{}) error {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return c.do(httpReq, resp)
+}
+
+func (c *Client) do(httpReq *http.Request, resp interface{}) error {
+	if c.idToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.idToken)
+	}
+
+	_, err := c.send(httpReq, resp)
+	return err
+}
+
+// send makes the request, returning the status if the server didn't refuse it
+func (c *Client) send(httpReq *http.Request, resp interface{}) (int, error) {
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if httpResp.StatusCode >= 400 {
+		errResp := &handlers.ErrorResponse{}
+		// Not every error comes back with a body we understand
+		json.Unmarshal(respBody, errResp)
+
+		return httpResp.StatusCode, &Error{
+			Status:  httpResp.StatusCode,
+			Code:    errResp.Code,
+			Message: errResp.Message,
+		}
+	}
+
+	return httpResp.StatusCode, json.Unmarshal(respBody, resp)
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// OpenBrowser opens the URL in the user's browser. The URL is printed too,
+// for when there's no browser to open or it opens somewhere unexpected.
+func OpenBrowser(url string) error {
+	fmt.Fprintf(os.Stderr, "Opening your browser to log in. If it doesn't open, visit:\n\n  %s\n\n", url)
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	// Not being able to open a browser is fine, the URL's been printed
+	cmd.Start()
+	return nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	ErrNoIDToken = errors.New("no id token in token response, credentials must be for a user")
+)
+
+// Scopes asked for when minting tokens. Refreshing a user's credentials keeps
+// the scopes they were originally granted, which for gcloud includes openid.
+var idTokenScopes = []string{"openid", "email"}
+
+// IDTokenFromCredentials mints a fresh ID token from a credentials file, like
+// the application default credentials gcloud writes. Files from a device
+// login against another provider carry its token URL, and are refreshed
+// there instead of at Google. Only the ID token ever leaves the machine - the
+// refresh token and client secret stay put.
+func IDTokenFromCredentials(ctx context.Context, credentials []byte) (string, error) {
+	user := &authorizedUser{}
+	if err := json.Unmarshal(credentials, user); err == nil && user.Type == authorizedUserType && user.TokenURL != "" {
+		return idTokenFromProvider(ctx, user)
+	}
+
+	creds, err := google.CredentialsFromJSON(ctx, credentials, idTokenScopes...)
+	if err != nil {
+		return "", err
+	}
+
+	return idTokenFromSource(creds.TokenSource)
+}
+
+// idTokenFromProvider refreshes the token with the provider that issued it
+func idTokenFromProvider(ctx context.Context, user *authorizedUser) (string, error) {
+	cfg := &oauth2.Config{
+		ClientID:     user.ClientID,
+		ClientSecret: user.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: user.TokenURL},
+	}
+
+	return idTokenFromSource(cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: user.RefreshToken}))
+}
+
+func idTokenFromSource(source oauth2.TokenSource) (string, error) {
+	token, err := source.Token()
+	if err != nil {
+		return "", err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return "", ErrNoIDToken
+	}
+
+	return rawIDToken, nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIDTokenFromProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("grant_type") != "refresh_token" || req.Form.Get("refresh_token") != "refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     "the-id-token",
+		})
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		refreshToken string
+		expected     string
+		expectErr    bool
+	}{
+		{refreshToken: "refresh", expected: "the-id-token"},
+		{refreshToken: "revoked", expectErr: true},
+	}
+
+	for i, tc := range testCases {
+		raw, _ := json.Marshal(authorizedUser{
+			Type:         authorizedUserType,
+			ClientID:     "client",
+			RefreshToken: tc.refreshToken,
+			TokenURL:     srv.URL,
+		})
+
+		idToken, err := IDTokenFromCredentials(context.Background(), raw)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("[%d] - Expected error %t, got %v", i, tc.expectErr, err)
+		}
+		if idToken != tc.expected {
+			t.Errorf("[%d] - Expected %q, got %q", i, tc.expected, idToken)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	callbackPath   = "/callback"
+	defaultTimeout = 5 * time.Minute
+)
+
+var (
+	ErrStateMismatch = errors.New("state in the redirect doesn't match the one sent")
+	ErrNoCode        = errors.New("no code in the redirect")
+	ErrTimeout       = errors.New("timed out waiting for the browser login")
+)
+
+// LoopbackFlow logs the user in with the OAuth installed app flow: the
+// browser is sent to the provider, which redirects back to a listener on
+// 127.0.0.1 with a code that's exchanged for tokens
+// https://developers.google.com/identity/protocols/oauth2/native-app
+type LoopbackFlow struct {
+	clientID     string
+	clientSecret string
+	endpoint     oauth2.Endpoint
+	scopes       []string
+	openBrowser  func(url string) error
+	timeout      time.Duration
+}
+
+// Options contains all LoopbackFlow options
+type Options struct {
+	Endpoint oauth2.Endpoint
+	Scopes   []string
+	// Called with the URL the user needs to visit
+	OpenBrowser func(url string) error
+	// How long to wait on the user to finish logging in
+	Timeout time.Duration
+}
+
+// Option is a functional way of setting options for the LoopbackFlow
+type Option func(o *Options)
+
+// WithEndpoint sets the provider's endpoint
+func WithEndpoint(e oauth2.Endpoint) Option {
+	return func(o *Options) {
+		o.Endpoint = e
+	}
+}
+
+// WithScopes sets the scopes asked for
+func WithScopes(scopes ...string) Option {
+	return func(o *Options) {
+		o.Scopes = scopes
+	}
+}
+
+// WithOpenBrowser sets how the login URL is opened
+func WithOpenBrowser(f func(url string) error) Option {
+	return func(o *Options) {
+		o.OpenBrowser = f
+	}
+}
+
+// WithTimeout sets how long to wait on the user
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Endpoint:    google.Endpoint,
+		Scopes:      idTokenScopes,
+		OpenBrowser: OpenBrowser,
+		Timeout:     defaultTimeout,
+	}
+}
+
+// NewLoopbackFlow creates a LoopbackFlow for the OAuth client. Installed app
+// clients can't keep a secret, so the secret isn't one - PKCE is what keeps
+// the code from being used by anyone else.
+func NewLoopbackFlow(clientID, clientSecret string, setOpts ...Option) *LoopbackFlow {
+	opts := defaultOptions()
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	return &LoopbackFlow{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		endpoint:     opts.Endpoint,
+		scopes:       opts.Scopes,
+		openBrowser:  opts.OpenBrowser,
+		timeout:      opts.Timeout,
+	}
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Token runs the flow and returns the tokens the provider hands back
+func (f *LoopbackFlow) Token(ctx context.Context) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	cfg := &oauth2.Config{
+		ClientID:     f.clientID,
+		ClientSecret: f.clientSecret,
+		Endpoint:     f.endpoint,
+		Scopes:       f.scopes,
+		RedirectURL:  fmt.Sprintf("http://%s%s", listener.Addr(), callbackPath),
+	}
+
+	state, err := oauth.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	pkce, err := oauth.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan callbackResult, 1)
+	srv := &http.Server{Handler: callbackHandler(state, results)}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	authURL := cfg.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		// Without consent, Google only hands out a refresh token the first time
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.SetAuthURLParam("code_challenge", pkce.Challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", oauth.PKCEMethod))
+
+	if err := f.openBrowser(authURL); err != nil {
+		return nil, err
+	}
+
+	var result callbackResult
+	select {
+	case result = <-results:
+	case <-time.After(f.timeout):
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	return cfg.Exchange(ctx, result.code, oauth2.SetAuthURLParam("code_verifier", pkce.Verifier))
+}
+
+// callbackHandler takes the first redirect that comes back and hands the code
+// over. Anything after that gets turned away.
+func callbackHandler(state string, results chan<- callbackResult) http.Handler {
+	var mu sync.Mutex
+	done := false
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if done {
+			http.Error(w, "Login already finished", http.StatusGone)
+			return
+		}
+
+		query := req.URL.Query()
+		result := callbackResult{code: query.Get("code")}
+		switch {
+		case query.Get("state") != state:
+			result.err = ErrStateMismatch
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("login failed: %s", query.Get("error"))
+		case result.code == "":
+			result.err = ErrNoCode
+		}
+
+		// A mismatched state could be anyone, so don't let it end the flow
+		if result.err == ErrStateMismatch {
+			http.Error(w, "Invalid login state", http.StatusBadRequest)
+			return
+		}
+
+		done = true
+		results <- result
+
+		if result.err != nil {
+			http.Error(w, "Login failed, check your terminal", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "Logged in! You can close this window.")
+	})
+	return mux
+}
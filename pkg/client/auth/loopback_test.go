@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"golang.org/x/oauth2"
+)
+
+// fakeProvider plays the provider's token endpoint, only handing out tokens
+// for the code it issued and the verifier matching the challenge it was sent
+type fakeProvider struct {
+	challenge   string
+	redirectURI string
+}
+
+func (p *fakeProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+
+	if req.Form.Get("code") != "the-code" ||
+		oauth.PKCEChallenge(req.Form.Get("code_verifier")) != p.challenge ||
+		req.Form.Get("redirect_uri") != p.redirectURI {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access",
+		"token_type":    "Bearer",
+		"refresh_token": "refresh",
+		"id_token":      "id",
+		"expires_in":    3600,
+	})
+}
+
+func TestLoopbackFlow(t *testing.T) {
+	provider := &fakeProvider{}
+	ts := httptest.NewServer(provider)
+	defer ts.Close()
+
+	// Plays the user's browser: checks what's being asked for, then follows
+	// the redirect back, after someone else tries to get in first
+	browser := func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+
+		if query.Get("code_challenge_method") != oauth.PKCEMethod || query.Get("code_challenge") == "" {
+			t.Errorf("Expected a PKCE challenge, got %s", authURL)
+		}
+		if query.Get("state") == "" {
+			t.Errorf("Expected a state, got %s", authURL)
+		}
+		provider.challenge = query.Get("code_challenge")
+		provider.redirectURI = query.Get("redirect_uri")
+
+		forged, err := http.Get(provider.redirectURI + "?code=forged&state=wrong")
+		if err != nil {
+			return err
+		}
+		forged.Body.Close()
+		if forged.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected a mismatched state to be refused, got %d", forged.StatusCode)
+		}
+
+		resp, err := http.Get(provider.redirectURI + "?code=the-code&state=" + url.QueryEscape(query.Get("state")))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	flow := NewLoopbackFlow("client", "secret",
+		WithEndpoint(oauth2.Endpoint{AuthURL: ts.URL + "/auth", TokenURL: ts.URL + "/token"}),
+		WithOpenBrowser(browser),
+		WithTimeout(5*time.Second))
+
+	token, err := flow.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if token.RefreshToken != "refresh" || token.Extra("id_token") != "id" {
+		t.Errorf("Expected the provider's tokens, got %+v", token)
+	}
+}
+
+func TestLoopbackFlowError(t *testing.T) {
+	browser := func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		query := u.Query()
+		resp, err := http.Get(query.Get("redirect_uri") + "?error=access_denied&state=" + url.QueryEscape(query.Get("state")))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	flow := NewLoopbackFlow("client", "secret", WithOpenBrowser(browser), WithTimeout(5*time.Second))
+
+	if _, err := flow.Token(context.Background()); err == nil {
+		t.Errorf("Expected a denied login to fail")
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "nested", "credentials.json"))
+
+	raw, err := store.Load()
+	if err != nil || raw != nil {
+		t.Errorf("Expected nothing stored yet, got %s (%v)", raw, err)
+	}
+
+	if err := store.Save("client", "secret", "", ""); err != ErrNoRefreshToken {
+		t.Errorf("Expected ErrNoRefreshToken, got %v", err)
+	}
+
+	if err := store.Save("client", "secret", "refresh", "https://idp.example.com/token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	raw, err = store.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := authorizedUser{}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := authorizedUser{Type: "authorized_user", ClientID: "client", ClientSecret: "secret", RefreshToken: "refresh", TokenURL: "https://idp.example.com/token"}
+	if got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	info, err := os.Stat(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected stored credentials to be 0600, got %v", info.Mode().Perm())
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
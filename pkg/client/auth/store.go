@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
+)
+
+const (
+	// Same format gcloud uses for application default credentials, so either
+	// can be read the same way
+	authorizedUserType = "authorized_user"
+)
+
+var (
+	ErrNoRefreshToken = errors.New("no refresh token was issued")
+)
+
+type authorizedUser struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	// Where the refresh token is used. Empty means Google, which is all
+	// gcloud's files are ever for.
+	TokenURL string `json:"token_url,omitempty"`
+}
+
+// Store keeps the user's Google credentials from `auth` on disk
+type Store struct {
+	path string
+}
+
+// NewStore creates a Store backed by the file at path
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultStorePath returns where credentials are stored by default
+func DefaultStorePath() (string, error) {
+	return file.WithUserHomeDir(".gsuite_aws_sso", "credentials.json")
+}
+
+// Save stores the refresh token along with the client it was issued to and
+// the provider's token URL, which is left empty for Google. Only the current
+// user can read it back.
+func (s *Store) Save(clientID, clientSecret, refreshToken, tokenURL string) error {
+	if refreshToken == "" {
+		return ErrNoRefreshToken
+	}
+
+	raw, err := json.MarshalIndent(authorizedUser{
+		Type:         authorizedUserType,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RefreshToken: refreshToken,
+		TokenURL:     tokenURL,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	return file.WriteFileAtomic(s.path, raw, 0600)
+}
+
+// Load returns the stored credentials file, or nil if nothing's been stored
+func (s *Store) Load() ([]byte, error) {
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return raw, err
+}
+
+// Delete removes the stored credentials
+func (s *Store) Delete() error {
+	err := os.Remove(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
+)
+
+// LookupFunc finds something out the slow way when the cache doesn't know it
+type LookupFunc func() (string, error)
+
+// Account returns the email of the Google account the credentials file
+// belongs to, calling lookup the first time it's seen. Entries are keyed by
+// the file's contents, so logging in as someone else is a new entry.
+func (c *Cache) Account(credentialFile []byte, lookup LookupFunc) (string, error) {
+	sum := sha256.Sum256(credentialFile)
+	path := filepath.Join(c.dir, "account-"+hex.EncodeToString(sum[:]))
+
+	if email, err := c.read(path); email != "" || err != nil {
+		return email, err
+	}
+
+	email, err := lookup()
+	if err != nil {
+		return "", err
+	}
+
+	return email, c.write(path, email)
+}
+
+// Role returns the role remembered for the key, or an empty string if there
+// isn't one
+func (c *Cache) Role(key string) (string, error) {
+	return c.read(c.rolePath(key))
+}
+
+// SetRole remembers the role chosen for the key, so the user isn't asked
+// again
+func (c *Cache) SetRole(key, role string) error {
+	return c.write(c.rolePath(key), role)
+}
+
+// ForgetRole drops the role remembered for the key
+func (c *Cache) ForgetRole(key string) error {
+	err := os.Remove(c.rolePath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *Cache) rolePath(key string) string {
+	return filepath.Join(c.dir, "role-"+key)
+}
+
+func (c *Cache) read(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+func (c *Cache) write(path, value string) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	return file.WriteFileAtomic(path, []byte(value+"\n"), 0600)
+}
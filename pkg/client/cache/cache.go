@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"github.com/gofrs/flock"
+)
+
+const (
+	// Cached credentials this close to expiring are treated as a miss, so
+	// callers never get handed something that dies mid request
+	DefaultRefreshWindow = 5 * time.Minute
+)
+
+// FetchFunc gets a fresh set of credentials when the cache can't help
+type FetchFunc func() (*handlers.Credentials, error)
+
+// Cache keeps temporary credentials on disk between runs of the client
+type Cache struct {
+	dir           string
+	refreshWindow time.Duration
+	now           func() time.Time
+}
+
+// New creates a Cache that stores credentials in dir. A zero refresh window
+// uses the default.
+func New(dir string, refreshWindow time.Duration) *Cache {
+	if refreshWindow <= 0 {
+		refreshWindow = DefaultRefreshWindow
+	}
+
+	return &Cache{
+		dir:           dir,
+		refreshWindow: refreshWindow,
+		now:           time.Now,
+	}
+}
+
+// DefaultDir returns where credentials are cached by default
+func DefaultDir() (string, error) {
+	return file.WithUserHomeDir(".gsuite_aws_sso", "cache")
+}
+
+// Key identifies the credentials for a role, as handed out by a server to a
+// profile for a Google account. Credentials asked for with a different
+// duration are a different entry, so a short session is never answered with
+// a long one.
+func Key(server, profile, email, role string, duration time.Duration) string {
+	fields := []string{server, profile, strings.ToLower(email), role, strconv.FormatInt(int64(duration/time.Second), 10)}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fetch returns the cached credentials for the key, calling fetch for new
+// ones when they're missing, about to expire, or force is set. The entry is
+// locked the whole time, so concurrent callers wait for the one fetch
+// instead of each going to the server.
+func (c *Cache) Fetch(key string, force bool, fetch FetchFunc) (*handlers.Credentials, error) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	lock := flock.New(c.path(key) + ".lock")
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	if !force {
+		creds, err := c.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			return creds, nil
+		}
+	}
+
+	creds, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	// Without an expiration there's no telling when the entry goes stale
+	if creds.Expiration.IsZero() {
+		return creds, nil
+	}
+
+	return creds, c.Put(key, creds)
+}
+
+// Get returns the cached credentials for the key, or nil if there aren't any
+// or they're about to expire
+func (c *Cache) Get(key string) (*handlers.Credentials, error) {
+	raw, err := ioutil.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &handlers.Credentials{}
+	// A corrupt entry is no worse than a missing one
+	if err := json.Unmarshal(raw, creds); err != nil {
+		return nil, nil
+	}
+
+	if !c.now().Add(c.refreshWindow).Before(creds.Expiration) {
+		return nil, nil
+	}
+
+	return creds, nil
+}
+
+// Put stores the credentials under the key. Only the current user can read
+// the entry back.
+func (c *Cache) Put(key string, creds *handlers.Credentials) error {
+	raw, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+
+	return file.WriteFileAtomic(c.path(key), raw, 0600)
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
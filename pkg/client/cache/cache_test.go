@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		expiration time.Time
+		hit        bool
+	}{
+		{expiration: now.Add(time.Hour), hit: true},
+		{expiration: now.Add(DefaultRefreshWindow + time.Second), hit: true},
+		{expiration: now.Add(DefaultRefreshWindow), hit: false},
+		{expiration: now.Add(time.Minute), hit: false},
+		{expiration: now.Add(-time.Minute), hit: false},
+	}
+
+	for i, tc := range cases {
+		c := New(dir, DefaultRefreshWindow)
+		c.now = func() time.Time { return now }
+
+		creds := &handlers.Credentials{
+			AccessKeyID:     "AKIA",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Expiration:      tc.expiration,
+		}
+		if err := c.Put("profile", creds); err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+
+		got, err := c.Get("profile")
+		if err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+
+		if tc.hit && (got == nil || got.AccessKeyID != creds.AccessKeyID) {
+			t.Errorf("[%d] - Expected a cache hit, got %v", i, got)
+		}
+		if !tc.hit && got != nil {
+			t.Errorf("[%d] - Expected a cache miss, got %v", i, got)
+		}
+	}
+}
+
+func TestCacheMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(dir, DefaultRefreshWindow)
+
+	got, err := c.Get("nothing-here")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("Expected a cache miss, got %v", got)
+	}
+
+	if err := ioutil.WriteFile(c.path("corrupt"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = c.Get("corrupt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("Expected a cache miss for a corrupt entry, got %v", got)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New(dir, DefaultRefreshWindow)
+	c.now = func() time.Time { return now }
+
+	fetches := 0
+	fetch := func(expiration time.Time) FetchFunc {
+		return func() (*handlers.Credentials, error) {
+			fetches++
+			return &handlers.Credentials{AccessKeyID: "AKIA", Expiration: expiration}, nil
+		}
+	}
+
+	cases := []struct {
+		key        string
+		force      bool
+		expiration time.Time
+		fetches    int
+	}{
+		// Nothing cached yet
+		{key: Key("server", "dev", "alice@example.com", "admin", time.Hour), expiration: now.Add(time.Hour), fetches: 1},
+		// Served from the cache
+		{key: Key("server", "dev", "alice@example.com", "admin", time.Hour), expiration: now.Add(time.Hour), fetches: 1},
+		// Forced past the cache
+		{key: Key("server", "dev", "alice@example.com", "admin", time.Hour), force: true, expiration: now.Add(time.Hour), fetches: 2},
+		// Different role, different entry
+		{key: Key("server", "dev", "alice@example.com", "readonly", time.Hour), expiration: time.Time{}, fetches: 3},
+		// Credentials without an expiration aren't cached
+		{key: Key("server", "dev", "alice@example.com", "readonly", time.Hour), expiration: time.Time{}, fetches: 4},
+		// Different account, different entry
+		{key: Key("server", "dev", "bob@example.com", "admin", time.Hour), expiration: now.Add(time.Hour), fetches: 5},
+		// Different duration, different entry
+		{key: Key("server", "dev", "bob@example.com", "admin", 15*time.Minute), expiration: now.Add(time.Hour), fetches: 6},
+		// No duration asked for is its own entry too
+		{key: Key("server", "dev", "bob@example.com", "admin", 0), expiration: now.Add(time.Hour), fetches: 7},
+	}
+
+	for i, tc := range cases {
+		creds, err := c.Fetch(tc.key, tc.force, fetch(tc.expiration))
+		if err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+		if creds.AccessKeyID != "AKIA" {
+			t.Errorf("[%d] - Expected credentials, got %+v", i, creds)
+		}
+		if fetches != tc.fetches {
+			t.Errorf("[%d] - Expected %d fetches, got %d", i, tc.fetches, fetches)
+		}
+	}
+
+	info, err := os.Stat(c.path(Key("server", "dev", "alice@example.com", "admin", time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected cache entry to be 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(dir, DefaultRefreshWindow)
+
+	lookups := 0
+	lookup := func(email string) LookupFunc {
+		return func() (string, error) {
+			lookups++
+			return email, nil
+		}
+	}
+
+	cases := []struct {
+		credentials string
+		email       string
+		expected    string
+		lookups     int
+	}{
+		{credentials: "alice", email: "alice@example.com", expected: "alice@example.com", lookups: 1},
+		// Already known
+		{credentials: "alice", email: "bob@example.com", expected: "alice@example.com", lookups: 1},
+		// New credentials are looked up
+		{credentials: "bob", email: "bob@example.com", expected: "bob@example.com", lookups: 2},
+	}
+
+	for i, tc := range cases {
+		email, err := c.Account([]byte(tc.credentials), lookup(tc.email))
+		if err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+		if email != tc.expected {
+			t.Errorf("[%d] - Expected %s, got %s", i, tc.expected, email)
+		}
+		if lookups != tc.lookups {
+			t.Errorf("[%d] - Expected %d lookups, got %d", i, tc.lookups, lookups)
+		}
+	}
+}
+
+func TestRole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := New(dir, DefaultRefreshWindow)
+	key := Key("server", "dev", "alice@example.com", "", 0)
+
+	if role, err := c.Role(key); role != "" || err != nil {
+		t.Errorf("Expected no role, got %q (%v)", role, err)
+	}
+
+	if err := c.SetRole(key, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := c.Role(key); role != "admin" || err != nil {
+		t.Errorf("Expected admin, got %q (%v)", role, err)
+	}
+
+	if err := c.ForgetRole(key); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := c.Role(key); role != "" || err != nil {
+		t.Errorf("Expected the role to be forgotten, got %q (%v)", role, err)
+	}
+}
@@ -0,0 +1,58 @@
+package clientcmd
+
+import (
+	"context"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/auth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Log into Google in the browser",
+	Long: `Log into Google in the browser, without needing gcloud. The credentials
+are kept in ~/.gsuite_aws_sso/credentials.json and used by every other command
+from then on.
+
+Needs a desktop OAuth client set in ~/.gsuite_aws_sso/config:
+
+  oauth:
+    client_id: <client id>
+    client_secret: <client secret>`,
+	Run: authenticate,
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+}
+
+func authenticate(cmd *cobra.Command, args []string) {
+	cfg, err := config.Get()
+	if err != nil {
+		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
+	}
+
+	if cfg.OAuth.ClientID == "" {
+		logging.Logger().Fatal("no OAuth client configured, set oauth.client_id in the config")
+	}
+
+	storePath, err := auth.DefaultStorePath()
+	if err != nil {
+		logging.Logger().Fatal("error getting home path", zap.Error(err))
+	}
+
+	flow := auth.NewLoopbackFlow(cfg.OAuth.ClientID, cfg.OAuth.ClientSecret)
+	token, err := flow.Token(context.Background())
+	if err != nil {
+		logging.Logger().Fatal("error logging in", zap.Error(err))
+	}
+
+	if err := auth.NewStore(storePath).Save(cfg.OAuth.ClientID, cfg.OAuth.ClientSecret, token.RefreshToken, ""); err != nil {
+		logging.Logger().Fatal("error storing credentials", zap.Error(err))
+	}
+
+	logging.Logger().Info("Logged into Google", zap.String("path", storePath))
+}
@@ -0,0 +1,81 @@
+package clientcmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	// The only version of the credential_process format there is
+	credentialProcessVersion = 1
+)
+
+var credentialProcessCmd = &cobra.Command{
+	Use:   "credential-process",
+	Short: "Print credentials for the AWS CLI and SDKs' credential_process",
+	Long: `Print credentials in the format the AWS CLI and SDKs expect from credential_process.
+
+Add this to ~/.aws/config to have the AWS tools fetch credentials on demand:
+
+  [profile dev]
+  credential_process = gsuite-aws-sso credential-process --profile dev
+
+Credentials are cached locally until they're close to expiring. Nothing is
+written to the AWS credentials file.`,
+	Run: credentialProcess,
+}
+
+func init() {
+	rootCmd.AddCommand(credentialProcessCmd)
+	credentialProcessCmd.Flags().StringVarP(&profileName, "profile", "p", config.DefaultProfileName, "Profile from the config to get credentials for")
+	credentialProcessCmd.Flags().BoolVar(&force, "force", false, "Get new credentials from the server even if there are cached ones that haven't expired")
+}
+
+// processCredentials is the output format of credential_process
+// https://docs.aws.amazon.com/cli/latest/userguide/cli-configure-sourcing-external.html
+type processCredentials struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// credentialProcess is called by the AWS tools, so it never prompts and
+// nothing but the credentials may go to stdout
+func credentialProcess(cmd *cobra.Command, args []string) {
+	cfg, err := config.Get()
+	if err != nil {
+		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
+	}
+
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		logging.Logger().Fatal("error getting profile", zap.String("profile", profileName), zap.Error(err))
+	}
+
+	creds, err := getCredentials(cfg, profile, force)
+	if err != nil {
+		logging.Logger().Fatal("error getting credentials", zap.String("profile", profileName), zap.Error(err))
+	}
+
+	out := processCredentials{
+		Version:         credentialProcessVersion,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+	}
+	if !creds.Expiration.IsZero() {
+		out.Expiration = creds.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+		logging.Logger().Fatal("error writing credentials", zap.Error(err))
+	}
+}
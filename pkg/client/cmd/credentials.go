@@ -0,0 +1,198 @@
+package clientcmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/api"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/auth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/cache"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/credentials"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoCredentials = errors.New("server sent back no credentials")
+)
+
+// newAPIClient creates a client for the server that identifies the user with
+// an ID token minted from their Google credentials
+func newAPIClient(cfg *config.Config) (*api.Client, error) {
+	credentialFile, err := googleCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := auth.IDTokenFromCredentials(context.Background(), credentialFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.New(cfg.Server, idToken), nil
+}
+
+// googleCredentials returns the credentials stored by `auth`, falling back to
+// the ones gcloud left on disk
+func googleCredentials(cfg *config.Config) ([]byte, error) {
+	storePath, err := auth.DefaultStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	credentialFile, err := auth.NewStore(storePath).Load()
+	if err != nil || credentialFile != nil {
+		return credentialFile, err
+	}
+
+	return ioutil.ReadFile(cfg.GCP.CredentialFilePath)
+}
+
+// newCredentialRequest builds the request the server expects for the profile
+func newCredentialRequest(profile *config.Profile) *handlers.CredentialHandlerRequest {
+	return &handlers.CredentialHandlerRequest{
+		Version:         handlers.CredentialResponseVersion,
+		Role:            profile.Role,
+		DurationSeconds: int64(profile.Duration / time.Second),
+	}
+}
+
+// newCache opens the client's cache of credentials, accounts and roles
+func newCache(cfg *config.Config) (*cache.Cache, error) {
+	cacheDir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(cacheDir, cfg.Cache.RefreshWindow), nil
+}
+
+// accountEmail returns the email of the Google account the client logs in as.
+// Google's only asked the first time the credentials are seen.
+func accountEmail(cfg *config.Config, credCache *cache.Cache) (string, error) {
+	credentialFile, err := googleCredentials(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return credCache.Account(credentialFile, func() (string, error) {
+		rawIDToken, err := auth.IDTokenFromCredentials(context.Background(), credentialFile)
+		if err != nil {
+			return "", err
+		}
+
+		idToken, err := oauth.ParseIDToken(rawIDToken)
+		if err != nil {
+			return "", err
+		}
+		return idToken.Email, nil
+	})
+}
+
+// chooseProfileRole fills in the profile's role, asking the user to pick one
+// if the profile doesn't name one and they have more than one. The choice is
+// remembered, so the server isn't asked for the user's roles on every run.
+func chooseProfileRole(cfg *config.Config, profile *config.Profile) error {
+	if profile.Role != "" {
+		return nil
+	}
+
+	credCache, err := newCache(cfg)
+	if err != nil {
+		return err
+	}
+
+	email, err := accountEmail(cfg, credCache)
+	if err != nil {
+		return err
+	}
+
+	roleKey := cache.Key(cfg.Server, profile.Name, email, "", 0)
+	profile.Role, err = credCache.Role(roleKey)
+	if err != nil || profile.Role != "" {
+		return err
+	}
+
+	client, err := newAPIClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	profile.Role, err = chooseRole(client, newCredentialRequest(profile), profile.Role)
+	if err != nil {
+		return err
+	}
+
+	return credCache.SetRole(roleKey, profile.Role)
+}
+
+// getCredentials returns the profile's credentials from the cache, going to
+// the server for new ones when they're missing, about to expire, or force is
+// set. The profile's region wins over the server's.
+func getCredentials(cfg *config.Config, profile *config.Profile, force bool) (*handlers.Credentials, error) {
+	credCache, err := newCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := accountEmail(cfg, credCache)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cache.Key(cfg.Server, profile.Name, email, profile.Role, profile.Duration)
+	creds, err := credCache.Fetch(key, force, func() (*handlers.Credentials, error) {
+		return requestCredentials(cfg, profile)
+	})
+	if apiErr, ok := err.(*api.Error); ok && (apiErr.Code == handlers.ErrorCodeRoleNotEntitled || apiErr.Code == handlers.ErrorCodeRoleDenied) {
+		// The role chosen last time may not be the user's any more, so
+		// they're asked again next time
+		credCache.ForgetRole(cache.Key(cfg.Server, profile.Name, email, "", 0))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if profile.Region != "" {
+		creds.Region = profile.Region
+	}
+
+	return creds, nil
+}
+
+// requestCredentials asks the server for the profile's credentials
+func requestCredentials(cfg *config.Config, profile *config.Profile) (*handlers.Credentials, error) {
+	client, err := newAPIClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Credentials(newCredentialRequest(profile))
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Logger().Debug("Got credentials",
+		zap.Duration("duration", time.Duration(resp.DurationSeconds)*time.Second),
+		zap.String("reason", resp.DurationReason))
+
+	return responseCredentials(resp)
+}
+
+// responseCredentials returns the credentials the server sent back
+func responseCredentials(resp *handlers.CredentialHandlerResponse) (*handlers.Credentials, error) {
+	if resp.Credentials == nil && len(resp.CredentialFile) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	// Older servers only send the rendered credentials file
+	if resp.Credentials == nil {
+		return credentials.FromLegacyFile(resp.CredentialFile)
+	}
+
+	return resp.Credentials, nil
+}
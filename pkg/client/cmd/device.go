@@ -0,0 +1,60 @@
+package clientcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/api"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/auth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	goauth "github.com/catherinetcai/gsuite-aws-sso/pkg/gsuite/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+)
+
+// deviceLogin logs into the server's identity provider with the device flow,
+// using the client the server hands out, and stores the credentials for the
+// rest of the login
+func deviceLogin(cfg *config.Config) error {
+	providerResp, err := api.New(cfg.Server, "").Provider()
+	if err != nil {
+		return err
+	}
+
+	provider := &oauth.Provider{
+		AuthURL:       providerResp.AuthURL,
+		TokenURL:      providerResp.TokenURL,
+		DeviceAuthURL: providerResp.DeviceAuthURL,
+		ClientID:      providerResp.ClientID,
+		ClientSecret:  providerResp.ClientSecret,
+		Scopes:        providerResp.Scopes,
+	}
+
+	ctx := context.Background()
+	flow := goauth.NewDeviceFlow(provider, nil)
+
+	code, err := flow.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	// stderr, so it's seen even when the credentials are being printed
+	fmt.Fprintf(os.Stderr, "To log in, visit %s and enter the code:\n\n  %s\n\n", code.URL(), code.UserCode)
+
+	token, err := flow.Poll(ctx, code)
+	if err != nil {
+		return err
+	}
+	// Without one, every later run would have to log in again
+	if token.RefreshToken == "" {
+		return auth.ErrNoRefreshToken
+	}
+
+	storePath, err := auth.DefaultStorePath()
+	if err != nil {
+		return err
+	}
+
+	// Refreshed wherever it was issued, which isn't always Google
+	return auth.NewStore(storePath).Save(provider.ClientID, provider.ClientSecret, token.RefreshToken, provider.TokenURL)
+}
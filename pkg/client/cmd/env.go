@@ -0,0 +1,79 @@
+package clientcmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/credentials"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	shell string
+	unset bool
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print shell statements that set AWS credentials",
+	Long: `Print shell statements that set AWS credentials in the environment, e.g.
+
+  eval "$(gsuite-aws-sso env --profile dev)"
+  gsuite-aws-sso env --profile dev --shell fish | source
+  gsuite-aws-sso env --profile dev --shell powershell | Invoke-Expression
+
+Use --unset to print statements that clear them again. Since the output is
+meant to be evaluated, there's no prompting for a role - set one on the
+profile or with --role if you have more than one.`,
+	Run: printEnv,
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.Flags().StringVarP(&profileName, "profile", "p", config.DefaultProfileName, "Profile from the config to get credentials for")
+	envCmd.Flags().StringVarP(&roleID, "role", "r", "", "ARN or alias of the role to assume. Overrides the profile's role.")
+	envCmd.Flags().DurationVarP(&duration, "duration", "d", 0, "How long the credentials should last, e.g. 1h. Overrides the profile's duration.")
+	envCmd.Flags().StringVarP(&shell, "shell", "s", "", fmt.Sprintf("Shell to print statements for (%s). Defaults to the shell in $SHELL.", strings.Join(credentials.Shells, ", ")))
+	envCmd.Flags().BoolVar(&force, "force", false, "Get new credentials from the server even if there are cached ones that haven't expired")
+	envCmd.Flags().BoolVar(&unset, "unset", false, "Print statements that clear the credentials instead")
+}
+
+func printEnv(cmd *cobra.Command, args []string) {
+	if shell == "" {
+		shell = credentials.DetectShell(os.Getenv("SHELL"))
+	}
+	if !oneOf(shell, credentials.Shells) {
+		logging.Logger().Fatal("unknown shell", zap.String("shell", shell), zap.Strings("shells", credentials.Shells))
+	}
+
+	if unset {
+		if err := credentials.RenderUnset(os.Stdout, shell); err != nil {
+			logging.Logger().Fatal("error printing statements", zap.String("shell", shell), zap.Error(err))
+		}
+		return
+	}
+
+	cfg, err := config.Get()
+	if err != nil {
+		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
+	}
+
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		logging.Logger().Fatal("error getting profile", zap.String("profile", profileName), zap.Error(err))
+	}
+	applyProfileFlags(cmd, profile)
+
+	creds, err := getCredentials(cfg, profile, force)
+	if err != nil {
+		logging.Logger().Fatal("error getting credentials", zap.String("profile", profileName), zap.Error(err))
+	}
+
+	if err := credentials.RenderShell(os.Stdout, shell, creds); err != nil {
+		logging.Logger().Fatal("error printing statements", zap.String("shell", shell), zap.Error(err))
+	}
+}
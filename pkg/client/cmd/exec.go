@@ -0,0 +1,116 @@
+package clientcmd
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/credentials"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Run a command with AWS credentials in its environment",
+	Long: `Run a command with AWS credentials in its environment, e.g.
+
+  gsuite-aws-sso exec --profile dev -- terraform plan
+
+The credentials are only handed to the command. Nothing is written to the AWS
+credentials file.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  execCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringVarP(&profileName, "profile", "p", config.DefaultProfileName, "Profile from the config to get credentials for")
+	execCmd.Flags().StringVarP(&roleID, "role", "r", "", "ARN or alias of the role to assume. Overrides the profile's role. Prompts for a role if you have more than one.")
+	execCmd.Flags().DurationVarP(&duration, "duration", "d", 0, "How long the credentials should last, e.g. 1h. Overrides the profile's duration.")
+	execCmd.Flags().BoolVar(&force, "force", false, "Get new credentials from the server even if there are cached ones that haven't expired")
+}
+
+// Signals passed on to the command, so it can clean up after itself
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP}
+
+// Signals the terminal already sends the whole foreground process group, so
+// the command gets them without our help. They're caught rather than ignored,
+// since the command would inherit them being ignored.
+var terminalSignals = []os.Signal{os.Interrupt, syscall.SIGQUIT}
+
+func execCommand(cmd *cobra.Command, args []string) {
+	cfg, err := config.Get()
+	if err != nil {
+		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
+	}
+
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		logging.Logger().Fatal("error getting profile", zap.String("profile", profileName), zap.Error(err))
+	}
+	applyProfileFlags(cmd, profile)
+
+	if err := chooseProfileRole(cfg, profile); err != nil {
+		logging.Logger().Fatal("error choosing role", zap.Error(err))
+	}
+
+	creds, err := getCredentials(cfg, profile, force)
+	if err != nil {
+		logging.Logger().Fatal("error getting credentials", zap.String("profile", profileName), zap.Error(err))
+	}
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = credentials.Environ(os.Environ(), creds)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	signal.Notify(sigs, terminalSignals...)
+
+	if err := child.Start(); err != nil {
+		logging.Logger().Fatal("error starting command", zap.String("command", args[0]), zap.Error(err))
+	}
+
+	go func() {
+		for sig := range sigs {
+			for _, forwarded := range forwardedSignals {
+				if sig == forwarded {
+					child.Process.Signal(sig)
+				}
+			}
+		}
+	}()
+
+	code := exitCode(child.Wait())
+	signal.Stop(sigs)
+	os.Exit(code)
+}
+
+// exitCode turns the result of running the command into our own exit code.
+// A command killed by a signal exits the way shells report it, 128 + signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		logging.Logger().Error("error running command", zap.Error(err))
+		return 1
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1
+	}
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
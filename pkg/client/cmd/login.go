@@ -1,16 +1,15 @@
 package clientcmd
 
 import (
-	"bytes"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
+	"fmt"
 	"os"
-	"path"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/api"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/credentials"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
@@ -19,7 +18,16 @@ import (
 	"go.uber.org/zap"
 )
 
-var credential string
+var (
+	credential  string
+	profileName string
+	roleID      string
+	duration    time.Duration
+	format      string
+	force       bool
+	device      bool
+	web         bool
+)
 
 var loginCmd = &cobra.Command{
 	Use:   "login",
@@ -30,6 +38,13 @@ var loginCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(loginCmd)
 	loginCmd.PersistentFlags().StringVarP(&credential, "credential", "c", defaultGCloudCredentialPath(), "Path to Google Cloud credentials file. Defaults to $HOME/.config/gcloud/application_default_credentials.json")
+	loginCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", config.DefaultProfileName, "Profile from the config to log in with")
+	loginCmd.PersistentFlags().StringVarP(&roleID, "role", "r", "", "ARN or alias of the role to log in as. Overrides the profile's role. Prompts for a role if you have more than one.")
+	loginCmd.PersistentFlags().DurationVarP(&duration, "duration", "d", 0, "How long the credentials should last, e.g. 1h. Overrides the profile's duration. Can only be shorter than what the server grants.")
+	loginCmd.PersistentFlags().BoolVar(&device, "device", false, "Log into Google with a code entered on another device, for when there's no browser here")
+	loginCmd.PersistentFlags().BoolVar(&web, "web", false, "Log in through the server in your browser, without needing Google credentials here")
+	loginCmd.PersistentFlags().BoolVar(&force, "force", false, "Get new credentials from the server even if there are cached ones that haven't expired")
+	loginCmd.PersistentFlags().StringVarP(&format, "format", "f", "", fmt.Sprintf("Print the credentials to stdout in this format (%s) instead of writing the AWS credentials file", strings.Join(credentials.Formats, ", ")))
 }
 
 func defaultGCloudCredentialPath() string {
@@ -43,115 +58,160 @@ func defaultGCloudCredentialPath() string {
 }
 
 func login(cmd *cobra.Command, args []string) {
+	if format != "" && !oneOf(format, credentials.Formats) {
+		logging.Logger().Fatal("unknown format", zap.String("format", format), zap.Strings("formats", credentials.Formats))
+	}
+
+	if device && web {
+		logging.Logger().Fatal("--device and --web can't be used together")
+	}
+
 	cfg, err := config.Get()
 	if err != nil {
 		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
 	}
 
-	// Read GCP credentials in
-	credentialFile, err := ioutil.ReadFile(cfg.GCP.CredentialFilePath)
+	profile, err := cfg.Profile(profileName)
 	if err != nil {
-		logging.Logger().Fatal("credentials file does not exist - you must login using GCloud", zap.Error(err))
+		logging.Logger().Fatal("error getting profile", zap.String("profile", profileName), zap.Error(err))
 	}
+	applyProfileFlags(cmd, profile)
 
-	// Before doing work, check the location of AWS file. If it exists, warn
-	// TODO: Pull this into its own function
-	exists, err := checkOutputCredentialsFileExist(cfg.AWS.CredentialOutputPath)
-	if err != nil {
-		logging.Logger().Fatal("something went wrong accessing the AWS credentials file", zap.Error(err))
+	// Before doing work, check whether we'd be clobbering a profile someone else wrote
+	if format == "" && !confirmOverwrite(cfg.AWS.CredentialOutputPath, profile.OutputProfile) {
+		logging.Logger().Info("Not overwriting AWS credentials, exiting...")
+		return
 	}
-	if exists {
-		overWritePrompt := promptui.Prompt{
-			Label:     "AWS Credentials already exists. Overwrite?",
-			IsConfirm: true,
-		}
 
-		result, err := overWritePrompt.Run()
-		if err != nil {
-			logging.Logger().Fatal("Something went wrong...")
+	if device {
+		if err := deviceLogin(cfg); err != nil {
+			logging.Logger().Fatal("error logging into Google", zap.Error(err))
 		}
+	}
 
-		if result == "N" {
-			logging.Logger().Info("Remove AWS credentials before logging in...")
+	// Without Google credentials here, there's no asking the server for the
+	// user's roles up front. The profile needs a role if they have several.
+	if !web {
+		if err := chooseProfileRole(cfg, profile); err != nil {
+			logging.Logger().Fatal("error choosing role", zap.Error(err))
 		}
 	}
 
-	logging.Logger().Info("Logging in...")
+	logging.Logger().Info("Logging in...", zap.String("profile", profileName), zap.String("role", profile.Role))
+	// The spinner draws on stdout, which is where printed credentials go
 	s := spinner.New(spinner.CharSets[4], 100*time.Millisecond)
-	s.Start()
-
-	// Create request and send it
-	// TODO: This client interaction should be put into a package
-	req := &handlers.CredentialHandlerRequest{CredentialFile: credentialFile}
-	client := &http.Client{}
+	if format == "" {
+		s.Start()
+	}
 
-	reqBytes, err := json.Marshal(req)
+	var creds *handlers.Credentials
+	if web {
+		creds, err = webLogin(cfg, profile)
+	} else {
+		creds, err = getCredentials(cfg, profile, force)
+	}
 	if err != nil {
-		logging.Logger().Fatal("error marshaling req", zap.Error(err))
+		s.Stop()
+		logging.Logger().Fatal("error trying to log in", zap.Error(err))
 	}
 
-	b := bytes.NewBuffer(reqBytes)
-
-	resp, err := client.Post(cfg.Server, "application/json", b)
-	if err != nil {
-		logging.Logger().Fatal("error posting to credentials", zap.Error(err))
+	if format != "" {
+		err = credentials.Render(os.Stdout, format, profile.OutputProfile, creds)
+	} else {
+		err = credentials.WriteProfile(cfg.AWS.CredentialOutputPath, profile.OutputProfile, credentials.Keys(creds))
 	}
+	s.Stop()
 
-	respBody, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
 	if err != nil {
-		logging.Logger().Fatal("error reading credential response", zap.Error(err))
+		logging.Logger().Fatal("error writing credentials", zap.Error(err))
 	}
 
-	if resp.StatusCode >= 400 {
-		logging.Logger().Fatal("error trying to log in", zap.Int("status", resp.StatusCode), zap.ByteString("error", respBody))
+	logging.Logger().Info("Logged in", zap.Time("expiration", creds.Expiration))
+}
+
+// chooseRole returns the requested role, or asks the server for the user's
+// roles and prompts for one if there's more than one to choose from
+func chooseRole(client *api.Client, req *handlers.CredentialHandlerRequest, requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
 	}
 
-	credentialResp := &handlers.CredentialHandlerResponse{}
+	rolesResp, err := client.Roles(req)
+	if err != nil {
+		return "", err
+	}
 
-	// Unmarshalling only to make sure that the response body is correct
-	if err := json.Unmarshal(respBody, credentialResp); err != nil {
-		logging.Logger().Fatal("error unmarshaling response", zap.Error(err))
+	switch len(rolesResp.Roles) {
+	case 0:
+		return "", fmt.Errorf("no roles available")
+	case 1:
+		return rolesResp.Roles[0].ARN, nil
 	}
 
-	err = writeCredentialsFile(cfg.AWS.CredentialOutputPath, credentialResp.CredentialFile)
-	s.Stop()
+	rolePrompt := promptui.Select{
+		Label: "Select a role",
+		Items: rolesResp.Roles,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   "> {{ .Alias | cyan }} ({{ .ARN }})",
+			Inactive: "  {{ .Alias }} ({{ .ARN }})",
+			Selected: "Role: {{ .ARN }}",
+		},
+	}
 
+	i, _, err := rolePrompt.Run()
 	if err != nil {
-		logging.Logger().Fatal("error writing credentials file", zap.Error(err))
+		return "", err
 	}
+
+	return rolesResp.Roles[i].ARN, nil
 }
 
-func checkOutputCredentialsFileExist(path string) (exists bool, err error) {
-	_, err = os.Open(path)
+// confirmOverwrite checks whether the profile can be written to. Profiles we
+// wrote ourselves are always fine to overwrite, anything else needs the
+// user's say so.
+func confirmOverwrite(path, profile string) bool {
+	status, err := credentials.GetProfileStatus(path, profile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = nil
-			return
-		}
-		return
+		logging.Logger().Fatal("something went wrong accessing the AWS credentials file", zap.Error(err))
 	}
 
-	return true, nil
-}
+	if status != credentials.ProfileUnmanaged {
+		return true
+	}
 
-func writeCredentialsFile(filePath string, body []byte) error {
-	dirPath := path.Dir(filePath)
-	if err := os.MkdirAll(dirPath, 0744); err != nil {
-		return err
+	overWritePrompt := promptui.Prompt{
+		Label:     fmt.Sprintf("AWS profile [%s] already exists. Overwrite?", profile),
+		IsConfirm: true,
 	}
 
-	cfgFile, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	_, err = overWritePrompt.Run()
+	if err == promptui.ErrAbort {
+		return false
+	}
 	if err != nil {
-		return err
+		logging.Logger().Fatal("Something went wrong...", zap.Error(err))
 	}
 
-	// Ensure file is empty
-	if err := cfgFile.Truncate(0); err != nil {
-		return err
+	return true
+}
+
+// oneOf checks whether the flag value is one of the allowed values
+func oneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
 	}
-	cfgFile.Seek(0, 0)
+	return false
+}
 
-	_, err = cfgFile.Write(body)
-	return err
+// applyProfileFlags lets the flags override what's set on the profile
+func applyProfileFlags(cmd *cobra.Command, profile *config.Profile) {
+	if cmd.Flags().Changed("role") {
+		profile.Role = roleID
+	}
+	if cmd.Flags().Changed("duration") {
+		profile.Duration = duration
+	}
 }
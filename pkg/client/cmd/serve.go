@@ -0,0 +1,178 @@
+package clientcmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/cache"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/endpoint"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	// Where serve looks for a token when there's no token file. It's the
+	// variable the SDKs send the token from, so one already exported is reused.
+	serveTokenEnv = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+)
+
+var (
+	ErrEmptyTokenFile = errors.New("token file is empty")
+)
+
+var (
+	port      int
+	listen    string
+	tokenFile string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve AWS credentials to the AWS SDKs over a local HTTP endpoint",
+	Long: `Serve AWS credentials over a loopback HTTP endpoint that works like the
+ECS container credentials endpoint. Credentials are refreshed in the
+background before they expire, and never written to disk outside the cache.
+
+Point the AWS SDKs at it with the variables printed on startup:
+
+  AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:<port>/
+  AWS_CONTAINER_AUTHORIZATION_TOKEN=<token>
+
+The token is read from --token-file, or $AWS_CONTAINER_AUTHORIZATION_TOKEN,
+and is random if neither is set. It's never taken as a flag, where anyone on
+the machine could read it from the process list.`,
+	Run: serve,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVarP(&profileName, "profile", "p", config.DefaultProfileName, "Profile from the config to serve credentials for")
+	serveCmd.Flags().StringVarP(&roleID, "role", "r", "", "ARN or alias of the role to assume. Overrides the profile's role. Prompts for a role if you have more than one.")
+	serveCmd.Flags().DurationVarP(&duration, "duration", "d", 0, "How long each set of credentials should last, e.g. 1h. Overrides the profile's duration.")
+	serveCmd.Flags().IntVar(&port, "port", 0, "Port to listen on. Defaults to any free port.")
+	serveCmd.Flags().StringVar(&listen, "listen", "127.0.0.1", "Address to listen on, as host or host:port. Anything but loopback exposes the credentials to the network, guarded only by the token.")
+	serveCmd.Flags().StringVar(&tokenFile, "token-file", "", "File holding the token requests must send in the Authorization header")
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	cfg, err := config.Get()
+	if err != nil {
+		logging.Logger().Fatal("config does not exist, try running config", zap.Error(err))
+	}
+
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		logging.Logger().Fatal("error getting profile", zap.String("profile", profileName), zap.Error(err))
+	}
+	applyProfileFlags(cmd, profile)
+
+	if err := chooseProfileRole(cfg, profile); err != nil {
+		logging.Logger().Fatal("error choosing role", zap.Error(err))
+	}
+
+	token, err := serveToken(tokenFile)
+	if err != nil {
+		logging.Logger().Fatal("error getting token", zap.Error(err))
+	}
+
+	address := listenAddress(listen, port)
+
+	refreshWindow := cfg.Cache.RefreshWindow
+	if refreshWindow <= 0 {
+		refreshWindow = cache.DefaultRefreshWindow
+	}
+
+	credEndpoint := endpoint.New(func() (*handlers.Credentials, error) {
+		return getCredentials(cfg, profile, false)
+	}, token, refreshWindow)
+
+	// Fail fast rather than leave the SDKs to find out
+	if _, err := credEndpoint.Credentials(); err != nil {
+		logging.Logger().Fatal("error getting credentials", zap.String("profile", profileName), zap.Error(err))
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logging.Logger().Fatal("error listening", zap.String("address", address), zap.Error(err))
+	}
+	if !isLoopback(listener.Addr()) {
+		logging.Logger().Warn("Serving credentials beyond this machine, anyone with the token can get them", zap.String("address", listener.Addr().String()))
+	}
+
+	stop := make(chan struct{})
+	go credEndpoint.Run(stop)
+
+	srv := &http.Server{Handler: credEndpoint}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stop)
+		srv.Close()
+	}()
+
+	fmt.Printf("export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/\n", listener.Addr())
+	fmt.Printf("export AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", token)
+	logging.Logger().Info("Serving credentials", zap.String("profile", profileName), zap.String("address", listener.Addr().String()))
+
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		logging.Logger().Fatal("error serving credentials", zap.Error(err))
+	}
+}
+
+// serveToken reads the token from the file, falling back to the environment
+// and then a random one
+func serveToken(path string) (string, error) {
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		token := strings.TrimSpace(string(raw))
+		if token == "" {
+			return "", ErrEmptyTokenFile
+		}
+		return token, nil
+	}
+
+	if token := os.Getenv(serveTokenEnv); token != "" {
+		return token, nil
+	}
+
+	return randomToken()
+}
+
+// listenAddress adds the port to the listen address unless it already has one
+func listenAddress(listen string, port int) string {
+	if _, _, err := net.SplitHostPort(listen); err == nil {
+		return listen
+	}
+	return net.JoinHostPort(strings.Trim(listen, "[]"), strconv.Itoa(port))
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && tcpAddr.IP.IsLoopback()
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
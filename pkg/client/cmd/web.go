@@ -0,0 +1,60 @@
+package clientcmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/api"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/auth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/client/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+var (
+	ErrWebLoginExpired = errors.New("browser login expired before it was finished")
+)
+
+// webLogin has the user log in through the server in their browser, and
+// picks up the profile's credentials once they're done. Nothing is kept
+// from the Google login itself. It skips the credential cache, since which
+// Google account logged in isn't known here to key the entry by.
+func webLogin(cfg *config.Config, profile *config.Profile) (*handlers.Credentials, error) {
+	client := api.New(cfg.Server, "")
+
+	sess, err := client.StartSession(newCredentialRequest(profile))
+	if err != nil {
+		return nil, err
+	}
+
+	// The browser won't go on without it, so a login link is no use to
+	// anyone but the person at this terminal
+	fmt.Fprintf(os.Stderr, "When asked in your browser, enter the code:\n\n  %s\n\n", sess.UserCode)
+	if err := auth.OpenBrowser(client.LoginURL(sess.ID)); err != nil {
+		return nil, err
+	}
+
+	for time.Now().Before(sess.ExpiresAt) {
+		// The server holds on to each pickup until the login finishes or a
+		// little while passes
+		resp, err := client.PickupCredentials(sess.ID, sess.Secret)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			continue
+		}
+
+		creds, err := responseCredentials(resp)
+		if err != nil {
+			return nil, err
+		}
+		if profile.Region != "" {
+			creds.Region = profile.Region
+		}
+		return creds, nil
+	}
+
+	return nil, ErrWebLoginExpired
+}
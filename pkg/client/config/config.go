@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
@@ -13,13 +15,45 @@ import (
 
 const (
 	DefaultServerURL = "http://localhost:3030/credentials"
+	// Profile used when no profile is asked for
+	DefaultProfileName = "default"
+)
+
+var (
+	ErrProfileNotFound = errors.New("profile not found in config")
 )
 
 // Config wraps all client configs
 type Config struct {
-	Server string `yaml:"server" json:"server"`
-	GCP    GCP    `yaml:"gcp" json:"gcp"`
-	AWS    AWS    `yaml:"aws" json:"aws"`
+	Server   string             `yaml:"server" json:"server"`
+	GCP      GCP                `yaml:"gcp" json:"gcp"`
+	AWS      AWS                `yaml:"aws" json:"aws"`
+	OAuth    OAuth              `yaml:"oauth,omitempty" json:"oauth,omitempty"`
+	Cache    Cache              `yaml:"cache,omitempty" json:"cache,omitempty"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+}
+
+// Cache wraps the configs for the local credential cache
+type Cache struct {
+	// Cached credentials are refreshed once they're this close to expiring.
+	// Defaults to 5 minutes.
+	RefreshWindow time.Duration `yaml:"refresh_window,omitempty" json:"refresh_window,omitempty"`
+}
+
+// Profile is a named set of login settings, so that credentials for several
+// roles can be kept side by side
+type Profile struct {
+	// Name the profile was looked up by
+	Name string `yaml:"-" json:"-"`
+	// ARN or alias of the role to log in as
+	Role string `yaml:"role,omitempty" json:"role,omitempty"`
+	// Region to set on the credentials. Defaults to the server's region.
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+	// How long the credentials should last. Defaults to what the server grants.
+	Duration time.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+	// Name of the profile written to the AWS credentials file. Defaults to
+	// the profile's name.
+	OutputProfile string `yaml:"output_profile,omitempty" json:"output_profile,omitempty"`
 }
 
 // GCP wraps all of the Google Cloud configs
@@ -28,6 +62,14 @@ type GCP struct {
 	CredentialFilePath string `yaml:"credential_file_path" json:"credential_file_path"`
 }
 
+// OAuth wraps the OAuth client used to log in with `auth`, without gcloud.
+// Must be a desktop (installed app) client.
+type OAuth struct {
+	ClientID string `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	// Desktop clients' secrets aren't actually secret
+	ClientSecret string `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+}
+
 // AWS wraps all of the AWS configs
 type AWS struct {
 	// Path where the AWS credential path goes - typically ~/.aws/credentials
@@ -69,6 +111,22 @@ func configPath() string {
 	return path
 }
 
+// Profile looks up a profile by name. The default profile doesn't need to be
+// configured, in which case it has no settings of its own.
+func (c *Config) Profile(name string) (*Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok && name != DefaultProfileName {
+		return nil, ErrProfileNotFound
+	}
+
+	profile.Name = name
+	if profile.OutputProfile == "" {
+		profile.OutputProfile = name
+	}
+
+	return &profile, nil
+}
+
 // Default returns a default Config instance
 func Default() *Config {
 	return &Config{
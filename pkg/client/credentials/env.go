@@ -0,0 +1,78 @@
+package credentials
+
+import (
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+// Environment variables that would get in the way of the credentials we set,
+// either by overriding them or by pointing the AWS tools somewhere else
+var conflictingEnvVars = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+}
+
+// The region variables only get in the way when the credentials come with a
+// region of their own
+var regionEnvVars = []string{
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+}
+
+// EnvVars returns the credentials as the environment variables the AWS tools
+// read
+func EnvVars(creds *handlers.Credentials) []Key {
+	vars := []Key{
+		{Name: "AWS_ACCESS_KEY_ID", Value: creds.AccessKeyID},
+		{Name: "AWS_SECRET_ACCESS_KEY", Value: creds.SecretAccessKey},
+		{Name: "AWS_SESSION_TOKEN", Value: creds.SessionToken},
+	}
+	if creds.Region != "" {
+		vars = append(vars,
+			Key{Name: "AWS_REGION", Value: creds.Region},
+			Key{Name: "AWS_DEFAULT_REGION", Value: creds.Region})
+	}
+	return vars
+}
+
+// Environ returns the environment with any AWS credentials or profile in it
+// swapped out for the credentials, in the KEY=value form os/exec takes. The
+// region is only swapped out if the credentials have one.
+func Environ(environ []string, creds *handlers.Credentials) []string {
+	env := []string{}
+	for _, kv := range environ {
+		if !conflicts(kv, creds.Region != "") {
+			env = append(env, kv)
+		}
+	}
+
+	for _, v := range EnvVars(creds) {
+		env = append(env, v.Name+"="+v.Value)
+	}
+
+	return env
+}
+
+func conflicts(kv string, withRegion bool) bool {
+	name := strings.SplitN(kv, "=", 2)[0]
+	if !withRegion && contains(regionEnvVars, name) {
+		return false
+	}
+	return contains(conflictingEnvVars, name)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
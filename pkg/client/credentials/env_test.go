@@ -0,0 +1,62 @@
+package credentials
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+func TestEnviron(t *testing.T) {
+	environ := []string{
+		"HOME=/home/jane",
+		"AWS_PROFILE=prod",
+		"AWS_ACCESS_KEY_ID=OLDKEY",
+		"AWS_SESSION_TOKEN_TTL=1h",
+		"AWS_REGION=eu-west-1",
+		"PATH=/usr/bin",
+	}
+
+	noRegion := *testCredentials
+	noRegion.Region = ""
+
+	testCases := []struct {
+		creds    *handlers.Credentials
+		expected []string
+	}{
+		// The credentials' region replaces the user's
+		{
+			creds: testCredentials,
+			expected: []string{
+				"HOME=/home/jane",
+				"AWS_SESSION_TOKEN_TTL=1h",
+				"PATH=/usr/bin",
+				"AWS_ACCESS_KEY_ID=AKIA",
+				"AWS_SECRET_ACCESS_KEY=se'cret",
+				"AWS_SESSION_TOKEN=token",
+				"AWS_REGION=us-west-2",
+				"AWS_DEFAULT_REGION=us-west-2",
+			},
+		},
+		// Without one, the user's region is left alone
+		{
+			creds: &noRegion,
+			expected: []string{
+				"HOME=/home/jane",
+				"AWS_SESSION_TOKEN_TTL=1h",
+				"AWS_REGION=eu-west-1",
+				"PATH=/usr/bin",
+				"AWS_ACCESS_KEY_ID=AKIA",
+				"AWS_SECRET_ACCESS_KEY=se'cret",
+				"AWS_SESSION_TOKEN=token",
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		got := Environ(environ, testCase.creds)
+		if !reflect.DeepEqual(got, testCase.expected) {
+			t.Errorf("[%d] - Expected %v, got %v", i, testCase.expected, got)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/file"
+	"github.com/gofrs/flock"
+	ini "gopkg.in/ini.v1"
+)
+
+const (
+	// Marks profiles written by us, so we know we can overwrite them
+	managedComment = "# Managed by gsuite-aws-sso"
+	// How many previous versions of the credentials file to keep around
+	maxBackups = 3
+)
+
+var (
+	ErrNoProfile = errors.New("no profile found in credential file")
+)
+
+// credentialSourceKeys tell the AWS SDKs to get credentials some other way.
+// They'd win over the keys we write, so they're dropped from profiles we take
+// over.
+var credentialSourceKeys = []string{
+	"role_arn",
+	"source_profile",
+	"credential_source",
+	"credential_process",
+	"external_id",
+	"mfa_serial",
+	"role_session_name",
+	"duration_seconds",
+	"web_identity_token_file",
+	"sso_session",
+	"sso_start_url",
+	"sso_region",
+	"sso_account_id",
+	"sso_role_name",
+}
+
+// Key is a single key in a profile
+type Key struct {
+	Name  string
+	Value string
+}
+
+// ProfileStatus describes what's in the credentials file for a profile
+type ProfileStatus int
+
+const (
+	// ProfileMissing means the profile isn't in the file yet
+	ProfileMissing ProfileStatus = iota
+	// ProfileManaged means the profile was written by us
+	ProfileManaged
+	// ProfileUnmanaged means the profile was written by someone else
+	ProfileUnmanaged
+)
+
+// KeysFromCredentialFile pulls the keys out of the first profile in the raw
+// credential file
+func KeysFromCredentialFile(raw []byte) ([]Key, error) {
+	f, err := ini.Load(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, section := range f.Sections() {
+		if section.Name() == ini.DEFAULT_SECTION {
+			continue
+		}
+
+		keys := []Key{}
+		for _, key := range section.Keys() {
+			keys = append(keys, Key{Name: key.Name(), Value: key.Value()})
+		}
+		return keys, nil
+	}
+
+	return nil, ErrNoProfile
+}
+
+// GetProfileStatus checks whether the profile exists in the credentials file,
+// and whether we were the ones that wrote it
+func GetProfileStatus(path, profile string) (ProfileStatus, error) {
+	f, err := ini.LooseLoad(path)
+	if err != nil {
+		return ProfileMissing, err
+	}
+
+	section, err := f.GetSection(profile)
+	if err != nil {
+		return ProfileMissing, nil
+	}
+
+	if isManaged(section) {
+		return ProfileManaged, nil
+	}
+	return ProfileUnmanaged, nil
+}
+
+// isManaged checks the section's comment for our marker
+func isManaged(section *ini.Section) bool {
+	for _, line := range strings.Split(section.Comment, "\n") {
+		if strings.TrimSpace(line) == managedComment {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteProfile merges the keys into the profile in the credentials file. Every
+// other profile, and any comments, are left as is. The file is locked while
+// it's rewritten, so concurrent logins can't drop each other's profiles. The
+// previous version of the file is kept as a backup, and the new one is
+// swapped in atomically so a failed write can't leave a half written file
+// behind.
+func WriteProfile(path, profile string, keys []Key) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	lock := flock.New(path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	f, err := ini.LooseLoad(path)
+	if err != nil {
+		return err
+	}
+
+	section, err := f.GetSection(profile)
+	if err != nil {
+		section, err = f.NewSection(profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !isManaged(section) {
+		for _, name := range credentialSourceKeys {
+			section.DeleteKey(name)
+		}
+
+		if section.Comment == "" {
+			section.Comment = managedComment
+		} else {
+			section.Comment += "\n" + managedComment
+		}
+	}
+
+	for _, key := range keys {
+		section.Key(key.Name).SetValue(key.Value)
+	}
+
+	var b bytes.Buffer
+	if _, err := f.WriteTo(&b); err != nil {
+		return err
+	}
+
+	if err := backup(path); err != nil {
+		return err
+	}
+
+	return file.WriteFileAtomic(path, b.Bytes(), 0600)
+}
+
+// backup copies the file to <path>.bak.1, shifting older backups along and
+// dropping the oldest
+func backup(path string) error {
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for i := maxBackups - 1; i > 0; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return file.WriteFileAtomic(backupPath(path, 1), current, 0600)
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.bak.%d", path, i)
+}
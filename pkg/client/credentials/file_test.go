@@ -0,0 +1,113 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const existingCredentials = `# Work account
+[work]
+aws_access_key_id     = WORKKEY
+aws_secret_access_key = WORKSECRET
+
+; Left over from last time
+[default]
+aws_access_key_id     = OLDKEY
+aws_secret_access_key = OLDSECRET
+aws_session_token     = OLDTOKEN
+region                = us-west-2
+role_arn              = arn:aws:iam::111111111111:role/old
+source_profile        = work
+`
+
+func TestWriteProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s\n", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(path, []byte(existingCredentials), 0600); err != nil {
+		t.Fatalf("Error writing credentials: %s\n", err.Error())
+	}
+
+	status, err := GetProfileStatus(path, "default")
+	if err != nil || status != ProfileUnmanaged {
+		t.Errorf("Expected unmanaged profile, got %d (%v)\n", status, err)
+	}
+
+	keys, err := KeysFromCredentialFile([]byte("[default]\naws_access_key_id = NEWKEY\naws_secret_access_key = NEWSECRET\naws_session_token = NEWTOKEN\n"))
+	if err != nil {
+		t.Fatalf("Error reading keys: %s\n", err.Error())
+	}
+
+	// Write a couple of times so the backups rotate
+	for i := 0; i < maxBackups; i++ {
+		if err := WriteProfile(path, "default", keys); err != nil {
+			t.Fatalf("Error writing profile: %s\n", err.Error())
+		}
+	}
+
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading credentials: %s\n", err.Error())
+	}
+
+	for _, expected := range []string{"# Work account", "WORKKEY", "WORKSECRET", "NEWKEY", "NEWSECRET", "NEWTOKEN", "us-west-2", managedComment,
+		// The profile's own comment is kept alongside the marker
+		"Left over from last time",
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("Expected credentials to contain %s, got:\n%s\n", expected, out)
+		}
+	}
+
+	for _, unexpected := range []string{"OLDKEY", "OLDSECRET", "OLDTOKEN", "role_arn", "source_profile"} {
+		if strings.Contains(string(out), unexpected) {
+			t.Errorf("Expected credentials not to contain %s, got:\n%s\n", unexpected, out)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading credentials: %s\n", err.Error())
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %o\n", info.Mode().Perm())
+	}
+
+	status, err = GetProfileStatus(path, "default")
+	if err != nil || status != ProfileManaged {
+		t.Errorf("Expected managed profile, got %d (%v)\n", status, err)
+	}
+
+	// The original file is the oldest backup still around
+	oldest, err := ioutil.ReadFile(backupPath(path, maxBackups))
+	if err != nil {
+		t.Fatalf("Error reading backup: %s\n", err.Error())
+	}
+	if string(oldest) != existingCredentials {
+		t.Errorf("Expected oldest backup to be the original file, got:\n%s\n", oldest)
+	}
+
+	if err := WriteProfile(path, "default", keys); err != nil {
+		t.Fatalf("Error writing profile: %s\n", err.Error())
+	}
+
+	if _, err := os.Stat(backupPath(path, maxBackups+1)); !os.IsNotExist(err) {
+		t.Errorf("Expected only %d backups to be kept\n", maxBackups)
+	}
+
+	// Rewriting a profile we manage doesn't stack up markers
+	out, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading credentials: %s\n", err.Error())
+	}
+	if count := strings.Count(string(out), managedComment); count != 1 {
+		t.Errorf("Expected one marker, got %d in:\n%s\n", count, out)
+	}
+}
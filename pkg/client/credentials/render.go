@@ -0,0 +1,94 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	ini "gopkg.in/ini.v1"
+)
+
+// Formats credentials can be rendered in
+const (
+	FormatINI  = "ini"
+	FormatJSON = "json"
+	FormatEnv  = "env"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown credential format")
+)
+
+// Formats lists every format Render understands
+var Formats = []string{FormatINI, FormatJSON, FormatEnv}
+
+// Keys returns the credentials as credentials file keys
+func Keys(creds *handlers.Credentials) []Key {
+	keys := []Key{
+		{Name: "aws_access_key_id", Value: creds.AccessKeyID},
+		{Name: "aws_secret_access_key", Value: creds.SecretAccessKey},
+		{Name: "aws_session_token", Value: creds.SessionToken},
+	}
+	if creds.Region != "" {
+		keys = append(keys, Key{Name: "region", Value: creds.Region})
+	}
+	return keys
+}
+
+// FromLegacyFile reads credentials out of the rendered credentials file older
+// servers send back. There's no expiration in there, so it's left zero.
+func FromLegacyFile(raw []byte) (*handlers.Credentials, error) {
+	keys, err := KeysFromCredentialFile(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &handlers.Credentials{}
+	for _, key := range keys {
+		switch key.Name {
+		case "aws_access_key_id":
+			creds.AccessKeyID = key.Value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = key.Value
+		case "aws_session_token":
+			creds.SessionToken = key.Value
+		case "region":
+			creds.Region = key.Value
+		}
+	}
+
+	return creds, nil
+}
+
+// Render writes the credentials out in the format. The profile is only used
+// to name the INI section.
+func Render(w io.Writer, format, profile string, creds *handlers.Credentials) error {
+	switch format {
+	case FormatINI:
+		return renderINI(w, profile, creds)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(creds)
+	case FormatEnv:
+		return RenderShell(w, ShellBash, creds)
+	}
+	return ErrUnknownFormat
+}
+
+func renderINI(w io.Writer, profile string, creds *handlers.Credentials) error {
+	f := ini.Empty()
+
+	section, err := f.NewSection(profile)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range Keys(creds) {
+		section.Key(key.Name).SetValue(key.Value)
+	}
+
+	_, err = f.WriteTo(w)
+	return err
+}
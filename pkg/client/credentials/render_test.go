@@ -0,0 +1,89 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+var testCredentials = &handlers.Credentials{
+	AccessKeyID:     "AKIA",
+	SecretAccessKey: "se'cret",
+	SessionToken:    "token",
+	Expiration:      time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC),
+	Region:          "us-west-2",
+	RoleARN:         "arn:aws:sts::111111111111:assumed-role/admin/jane",
+	AccountID:       "111111111111",
+}
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		format   string
+		expected []string
+	}{
+		{
+			format:   FormatINI,
+			expected: []string{"[dev]", "aws_access_key_id", "AKIA", "aws_session_token", "region", "us-west-2"},
+		},
+		{
+			format:   FormatEnv,
+			expected: []string{"export AWS_ACCESS_KEY_ID='AKIA'\n", `export AWS_SECRET_ACCESS_KEY='se'\''cret'`, "export AWS_REGION='us-west-2'\n"},
+		},
+	}
+
+	for i, tc := range cases {
+		var b bytes.Buffer
+		if err := Render(&b, tc.format, "dev", testCredentials); err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+
+		for _, expected := range tc.expected {
+			if !strings.Contains(b.String(), expected) {
+				t.Errorf("[%d] - Expected output to contain %q, got:\n%s", i, expected, b.String())
+			}
+		}
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, FormatJSON, "dev", testCredentials); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := &handlers.Credentials{}
+	if err := json.Unmarshal(b.Bytes(), got); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *got != *testCredentials {
+		t.Errorf("Expected %+v, got %+v", testCredentials, got)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	var b bytes.Buffer
+	if err := Render(&b, "xml", "dev", testCredentials); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestFromLegacyFile(t *testing.T) {
+	creds, err := FromLegacyFile([]byte("[default]\naws_access_key_id = AKIA\naws_secret_access_key = secret\naws_session_token = token\nregion = us-west-2\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := handlers.Credentials{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Region:          "us-west-2",
+	}
+	if *creds != expected {
+		t.Errorf("Expected %+v, got %+v", expected, creds)
+	}
+}
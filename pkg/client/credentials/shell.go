@@ -0,0 +1,109 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+// Shells we know how to write statements for
+const (
+	ShellBash       = "bash"
+	ShellZsh        = "zsh"
+	ShellFish       = "fish"
+	ShellPowerShell = "powershell"
+)
+
+var (
+	ErrUnknownShell = errors.New("unknown shell")
+)
+
+// Shells lists every shell RenderShell understands
+var Shells = []string{ShellBash, ShellZsh, ShellFish, ShellPowerShell}
+
+// DetectShell guesses the shell from the path in $SHELL, falling back to bash
+func DetectShell(shellPath string) string {
+	name := strings.TrimSuffix(filepath.Base(shellPath), ".exe")
+	switch name {
+	case ShellZsh, ShellFish:
+		return name
+	case "pwsh", ShellPowerShell:
+		return ShellPowerShell
+	}
+	return ShellBash
+}
+
+// RenderShell writes statements that set the credentials in the shell's
+// environment
+func RenderShell(w io.Writer, shell string, creds *handlers.Credentials) error {
+	format, quote, err := shellSetSyntax(shell)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range EnvVars(creds) {
+		if _, err := fmt.Fprintf(w, format, v.Name, quote(v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderUnset writes statements that clear the credentials from the shell's
+// environment, along with anything else that would get in the way of the
+// next ones, like a profile
+func RenderUnset(w io.Writer, shell string) error {
+	var format string
+	switch shell {
+	case ShellBash, ShellZsh:
+		format = "unset %s\n"
+	case ShellFish:
+		format = "set -e %s;\n"
+	case ShellPowerShell:
+		format = "Remove-Item Env:%s -ErrorAction SilentlyContinue\n"
+	default:
+		return ErrUnknownShell
+	}
+
+	for _, name := range conflictingEnvVars {
+		if _, err := fmt.Fprintf(w, format, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shellSetSyntax(shell string) (string, func(string) string, error) {
+	switch shell {
+	case ShellBash, ShellZsh:
+		return "export %s=%s\n", shellQuote, nil
+	case ShellFish:
+		return "set -gx %s %s;\n", fishQuote, nil
+	case ShellPowerShell:
+		return "$Env:%s = %s\n", powerShellQuote, nil
+	}
+	return "", nil, ErrUnknownShell
+}
+
+// shellQuote wraps the value in single quotes, which POSIX shells take
+// literally
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote wraps the value in single quotes. Inside them fish still treats
+// backslashes and single quotes specially, so those get escaped.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// powerShellQuote wraps the value in single quotes, where the only escape is
+// doubling up single quotes
+func powerShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
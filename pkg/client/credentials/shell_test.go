@@ -0,0 +1,96 @@
+package credentials
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderShell(t *testing.T) {
+	cases := []struct {
+		shell    string
+		expected []string
+	}{
+		{
+			shell:    ShellBash,
+			expected: []string{"export AWS_ACCESS_KEY_ID='AKIA'\n", `export AWS_SECRET_ACCESS_KEY='se'\''cret'` + "\n", "export AWS_DEFAULT_REGION='us-west-2'\n"},
+		},
+		{
+			shell:    ShellZsh,
+			expected: []string{"export AWS_SESSION_TOKEN='token'\n"},
+		},
+		{
+			shell:    ShellFish,
+			expected: []string{"set -gx AWS_ACCESS_KEY_ID 'AKIA';\n", `set -gx AWS_SECRET_ACCESS_KEY 'se\'cret';` + "\n"},
+		},
+		{
+			shell:    ShellPowerShell,
+			expected: []string{"$Env:AWS_ACCESS_KEY_ID = 'AKIA'\n", "$Env:AWS_SECRET_ACCESS_KEY = 'se''cret'\n"},
+		},
+	}
+
+	for i, tc := range cases {
+		var b bytes.Buffer
+		if err := RenderShell(&b, tc.shell, testCredentials); err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+
+		for _, expected := range tc.expected {
+			if !strings.Contains(b.String(), expected) {
+				t.Errorf("[%d] - Expected output to contain %q, got:\n%s", i, expected, b.String())
+			}
+		}
+	}
+
+	if err := RenderShell(&bytes.Buffer{}, "tcsh", testCredentials); err != ErrUnknownShell {
+		t.Errorf("Expected ErrUnknownShell, got %v", err)
+	}
+}
+
+func TestRenderUnset(t *testing.T) {
+	cases := []struct {
+		shell    string
+		expected string
+	}{
+		{shell: ShellBash, expected: "unset AWS_SESSION_TOKEN\n"},
+		{shell: ShellFish, expected: "set -e AWS_SESSION_TOKEN;\n"},
+		{shell: ShellPowerShell, expected: "Remove-Item Env:AWS_SESSION_TOKEN -ErrorAction SilentlyContinue\n"},
+		// A profile would point the AWS tools away from the next credentials
+		{shell: ShellBash, expected: "unset AWS_PROFILE\n"},
+		{shell: ShellBash, expected: "unset AWS_SECURITY_TOKEN\n"},
+	}
+
+	for i, tc := range cases {
+		var b bytes.Buffer
+		if err := RenderUnset(&b, tc.shell); err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+
+		if !strings.Contains(b.String(), tc.expected) {
+			t.Errorf("[%d] - Expected output to contain %q, got:\n%s", i, tc.expected, b.String())
+		}
+		if strings.Count(b.String(), "\n") != len(conflictingEnvVars) {
+			t.Errorf("[%d] - Expected every variable to be cleared, got:\n%s", i, b.String())
+		}
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/bin/bash", expected: ShellBash},
+		{path: "/usr/local/bin/zsh", expected: ShellZsh},
+		{path: "/usr/bin/fish", expected: ShellFish},
+		{path: "/usr/bin/pwsh", expected: ShellPowerShell},
+		{path: "/bin/sh", expected: ShellBash},
+		{path: "", expected: ShellBash},
+	}
+
+	for i, tc := range cases {
+		if got := DetectShell(tc.path); got != tc.expected {
+			t.Errorf("[%d] - Expected %s for %q, got %s", i, tc.expected, tc.path, got)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package endpoint
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+
+	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+)
+
+const (
+	// How long to wait before trying again after a failed refresh
+	retryInterval = 30 * time.Second
+	// How long to wait between refreshes when the credentials don't say
+	// when they expire
+	defaultRefreshInterval = time.Hour
+)
+
+// Provider gets a fresh set of credentials
+type Provider func() (*handlers.Credentials, error)
+
+// Endpoint serves credentials the way the ECS container credentials endpoint
+// does, so the AWS SDKs can be pointed at it with
+// AWS_CONTAINER_CREDENTIALS_FULL_URI and AWS_CONTAINER_AUTHORIZATION_TOKEN
+type Endpoint struct {
+	provider      Provider
+	token         string
+	refreshWindow time.Duration
+	now           func() time.Time
+
+	mu    sync.Mutex
+	creds *handlers.Credentials
+}
+
+// containerCredentials is the response format of the ECS credentials endpoint
+type containerCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration,omitempty"`
+	RoleArn         string `json:"RoleArn,omitempty"`
+}
+
+// New creates an Endpoint that hands out the provider's credentials to
+// requests carrying the token. Credentials are refreshed once they're within
+// the refresh window of expiring.
+func New(provider Provider, token string, refreshWindow time.Duration) *Endpoint {
+	return &Endpoint{
+		provider:      provider,
+		token:         token,
+		refreshWindow: refreshWindow,
+		now:           time.Now,
+	}
+}
+
+// Credentials returns the current credentials, refreshing them first if
+// they're about to expire. Concurrent callers share the one refresh.
+func (e *Endpoint) Credentials() (*handlers.Credentials, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.fresh() {
+		return e.creds, nil
+	}
+
+	creds, err := e.provider()
+	if err != nil {
+		// Better to keep handing out credentials that are about to expire
+		// than none at all
+		if e.creds != nil && e.now().Before(e.creds.Expiration) {
+			logging.Logger().Warn("error refreshing credentials, serving the old ones", zap.Error(err))
+			return e.creds, nil
+		}
+		return nil, err
+	}
+
+	e.creds = creds
+	return e.creds, nil
+}
+
+func (e *Endpoint) fresh() bool {
+	if e.creds == nil {
+		return false
+	}
+	if e.creds.Expiration.IsZero() {
+		return true
+	}
+	return e.now().Add(e.refreshWindow).Before(e.creds.Expiration)
+}
+
+// Run refreshes the credentials in the background ahead of them expiring,
+// so requests don't have to wait on the server. It returns once stop is
+// closed.
+func (e *Endpoint) Run(stop <-chan struct{}) {
+	for {
+		wait := retryInterval
+
+		creds, err := e.Credentials()
+		if err != nil {
+			logging.Logger().Error("error refreshing credentials", zap.Error(err))
+		} else if creds.Expiration.IsZero() {
+			wait = defaultRefreshInterval
+		} else if untilRefresh := creds.Expiration.Sub(e.now()) - e.refreshWindow; untilRefresh > wait {
+			wait = untilRefresh
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ServeHTTP hands out the credentials to requests with the right token
+func (e *Endpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		httphelper.JSONResponse(w, struct{}{}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := req.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(e.token)) != 1 {
+		logging.Logger().Warn("refused credentials request without a valid token", zap.String("remote", req.RemoteAddr))
+		httphelper.JSONResponse(w, struct{}{}, http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := e.Credentials()
+	if err != nil {
+		logging.Logger().Error("error getting credentials", zap.Error(err))
+		httphelper.JSONResponse(w, struct{}{}, http.StatusInternalServerError)
+		return
+	}
+
+	response := containerCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		RoleArn:         creds.RoleARN,
+	}
+	if !creds.Expiration.IsZero() {
+		response.Expiration = creds.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	httphelper.JSONResponse(w, response, http.StatusOK)
+}
@@ -0,0 +1,156 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+const testToken = "secret-token"
+
+type testProvider struct {
+	mu         sync.Mutex
+	calls      int
+	expiration time.Time
+	err        error
+}
+
+func (p *testProvider) provide() (*handlers.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &handlers.Credentials{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      p.expiration,
+	}, nil
+}
+
+func TestServeHTTP(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := &testProvider{expiration: now.Add(time.Hour)}
+
+	e := New(provider.provide, testToken, 5*time.Minute)
+	e.now = func() time.Time { return now }
+
+	cases := []struct {
+		method string
+		token  string
+		status int
+	}{
+		{method: http.MethodGet, token: testToken, status: http.StatusOK},
+		{method: http.MethodGet, token: "", status: http.StatusUnauthorized},
+		{method: http.MethodGet, token: "wrong", status: http.StatusUnauthorized},
+		{method: http.MethodPost, token: testToken, status: http.StatusMethodNotAllowed},
+	}
+
+	for i, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", tc.token)
+		}
+		w := httptest.NewRecorder()
+
+		e.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("[%d] - Expected status %d, got %d", i, tc.status, w.Code)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		got := containerCredentials{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+		expected := containerCredentials{
+			AccessKeyID:     "AKIA",
+			SecretAccessKey: "secret",
+			Token:           "token",
+			Expiration:      "2019-01-01T13:00:00Z",
+		}
+		if got != expected {
+			t.Errorf("[%d] - Expected %+v, got %+v", i, expected, got)
+		}
+	}
+}
+
+func TestCredentialsConcurrent(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := &testProvider{expiration: now.Add(time.Hour)}
+
+	e := New(provider.provide, testToken, 5*time.Minute)
+	e.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := e.Credentials(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if provider.calls != 1 {
+		t.Errorf("Expected concurrent requests to share one fetch, got %d", provider.calls)
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	provider := &testProvider{expiration: now.Add(time.Hour)}
+
+	e := New(provider.provide, testToken, 5*time.Minute)
+	e.now = func() time.Time { return now }
+
+	cases := []struct {
+		now   time.Time
+		err   error
+		calls int
+		ok    bool
+	}{
+		{now: now, calls: 1, ok: true},
+		// Still fresh
+		{now: now.Add(50 * time.Minute), calls: 1, ok: true},
+		// Inside the refresh window, but the refresh fails so the old ones
+		// are served
+		{now: now.Add(56 * time.Minute), err: errors.New("server down"), calls: 2, ok: true},
+		// Expired and the refresh still fails
+		{now: now.Add(61 * time.Minute), err: errors.New("server down"), calls: 3, ok: false},
+		// Back up again
+		{now: now.Add(62 * time.Minute), calls: 4, ok: true},
+	}
+
+	for i, tc := range cases {
+		e.now = func() time.Time { return tc.now }
+		provider.err = tc.err
+		provider.expiration = tc.now.Add(time.Hour)
+
+		_, err := e.Credentials()
+		if tc.ok && err != nil {
+			t.Errorf("[%d] - Unexpected error: %v", i, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("[%d] - Expected an error", i)
+		}
+		if provider.calls != tc.calls {
+			t.Errorf("[%d] - Expected %d calls, got %d", i, tc.calls, provider.calls)
+		}
+	}
+}
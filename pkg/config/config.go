@@ -3,16 +3,35 @@ package config
 import (
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
 	_ "github.com/joho/godotenv/autoload"
 	goconfig "github.com/micro/go-config"
 	"github.com/micro/go-config/source/env"
+	"go.uber.org/zap"
 )
 
 // NOTE: I may want to rethink this entire approach.
 // I'm just not very happy with the way that Viper does things.
 // This is an experiment with go-config.
 
+// Identity providers users can log in with
+const (
+	OAuthProviderGoogle = "google"
+	OAuthProviderOIDC   = "oidc"
+)
+
+// Where users and their roles are looked up
+const (
+	DirectoryProviderGSuite = "gsuite"
+	DirectoryProviderFile   = "file"
+	DirectoryProviderLDAP   = "ldap"
+)
+
+// The shortest session STS hands out, so no role can be capped below it
+const minSessionDuration = 15 * time.Minute
+
 var (
 	gocfg    goconfig.Config
 	instance *Config
@@ -21,13 +40,38 @@ var (
 
 // Config ...
 type Config struct {
-	GSuite GSuite `json:"gsuite"`
-	OAuth  OAuth  `json:"oauth"`
-	Server Server `json:"server"`
+	GSuite    GSuite    `json:"gsuite"`
+	Directory Directory `json:"directory"`
+	OAuth     OAuth     `json:"oauth"`
+	Identity  Identity  `json:"identity"`
+	Policy    Policy    `json:"policy"`
+	AWS       AWS       `json:"aws"`
+	Server    Server    `json:"server"`
 }
 
 // AWS encapsulates all AWS configs
-type AWS struct{}
+type AWS struct {
+	SessionDuration SessionDuration `json:"session_duration"`
+	// Session tags to attach to assumed roles. Will come in as a comma delimited
+	// list of <tag key>=<directory attribute>, e.g. Department=department
+	SessionTags map[string]string `json:"session_tags"`
+	// Whether to set the user's email as the source identity of sessions.
+	// Off by default, since roles' trust policies need to allow
+	// sts:SetSourceIdentity first.
+	SourceIdentity bool `json:"source_identity"`
+}
+
+// SessionDuration encapsulates the limits on how long issued credentials last
+type SessionDuration struct {
+	// Used when the user doesn't have a session duration set in the directory
+	Default time.Duration `json:"default"`
+	// Hard cap across every role
+	Max time.Duration `json:"max"`
+	// Cap for individual roles, keyed by role ARN. Will come in as a comma
+	// delimited list of <role arn>=<duration>. Caps under 15 minutes are
+	// skipped. The role's own MaxSessionDuration in IAM still applies.
+	RoleMax map[string]time.Duration `json:"role_max"`
+}
 
 // GSuite encapsulates all GSuite service info
 type GSuite struct {
@@ -43,10 +87,62 @@ type GSuite struct {
 	ClientID            string `json:"client_id"`
 	ServiceAccountEmail string `json:"service_account_email"`
 	ImpersonationEmail  string `json:"impersonation_email"`
+	// Roles granted to members of Google Groups, including nested members.
+	// Will come in as a semicolon delimited list of
+	// <group email>=<role arn>,<provider arn>
+	GroupRoles map[string]string `json:"group_roles"`
+}
+
+// Directory encapsulates where users are looked up
+type Directory struct {
+	// gsuite, file or ldap
+	Provider string `json:"provider"`
+	// Path to the YAML file users are read from by the file provider
+	Path string `json:"path"`
+	// How often the file is checked for changes
+	ReloadInterval time.Duration `json:"reload_interval"`
+	LDAP           LDAP          `json:"ldap"`
+	// How long looked up users are cached for. Zero doesn't cache them.
+	CacheTTL time.Duration `json:"cache_ttl"`
+	// How long users that weren't found are cached for. Zero doesn't cache
+	// them.
+	CacheNegativeTTL time.Duration `json:"cache_negative_ttl"`
+}
+
+// LDAP encapsulates the configs for looking users up in LDAP
+type LDAP struct {
+	// ldap://host[:port] or ldaps://host[:port]
+	URL      string `json:"url"`
+	StartTLS bool   `json:"start_tls"`
+	// Extra CA to trust for the server's certificate
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	BindDN             string `json:"bind_dn"`
+	BindPassword       string `json:"bind_password"`
+	BaseDN             string `json:"base_dn"`
+	// Finds the user, with %s replaced by their email
+	UserFilter string `json:"user_filter"`
+	// Attribute on the user holding roles as <role arn>,<provider arn>
+	RoleAttribute  string `json:"role_attribute"`
+	GroupAttribute string `json:"group_attribute"`
+	// Search for groups here instead of reading them off the user
+	GroupBaseDN string `json:"group_base_dn"`
+	GroupFilter string `json:"group_filter"`
+	// Roles granted to groups. Will come in as a semicolon delimited list of
+	// <group dn>=<role arn>,<provider arn>
+	GroupRoles map[string]string `json:"group_roles"`
+	// Directory attributes to copy onto users, in the same format as
+	// AWS_SESSION_TAGS, e.g. department=departmentNumber
+	Attributes map[string]string `json:"attributes"`
+	PoolSize   int               `json:"pool_size"`
 }
 
 // OAuth encapsulates all OAuth configs
 type OAuth struct {
+	// Which identity provider users log in with, google or oidc
+	Provider string `json:"provider"`
+	// The OIDC provider's issuer, whose endpoints are found through discovery
+	IssuerURL    string `json:"issuer_url"`
 	ClientID     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
 	// Scopes will come in as a comma delimited string
@@ -54,13 +150,58 @@ type OAuth struct {
 	TokenURL                string        `json:"token_url"`
 	AuthURL                 string        `json:"auth_url"`
 	RedirectURL             string        `json:"redirect_url"`
-	StateParameterGenerator func() string `json:"-"`
+	StateParameterGenerator func() string `json:"-"` // Defaults to random states
+	// Audiences accepted on incoming ID tokens. Will come in as a comma
+	// delimited string, and defaults to the client ID.
+	Audiences []string `json:"audiences"`
+	// How far off an ID token's exp and iat claims may be from our clock
+	ClockSkew time.Duration `json:"clock_skew"`
+	// The public (TVs and limited input devices) client handed to clients for
+	// the device flow. Tokens issued to it are accepted as well.
+	DeviceClientID     string `json:"device_client_id"`
+	DeviceClientSecret string `json:"device_client_secret"`
+}
+
+// Identity encapsulates the policy incoming identities must meet before
+// they're allowed to get credentials
+type Identity struct {
+	// Hosted (GSuite) domains users must belong to. Will come in as a comma
+	// delimited string. If empty, any domain is allowed.
+	AllowedHostedDomains []string `json:"allowed_hosted_domains"`
+	// Client IDs the ID token must have been issued to. Will come in as a comma
+	// delimited string. If empty, any audience the token verifier accepts is allowed.
+	AllowedAudiences []string `json:"allowed_audiences"`
+	// Whether the user's email must be verified by the identity provider
+	RequireEmailVerified bool `json:"require_email_verified"`
+	// Whether to still accept requests from older clients that send their
+	// whole gcloud credentials file instead of an ID token
+	AllowCredentialFile bool `json:"allow_credential_file"`
+	// Whether to refuse users whose directory account is suspended or
+	// archived
+	DenySuspended bool `json:"deny_suspended"`
+	DenyArchived  bool `json:"deny_archived"`
+	// Whether users must have 2-Step Verification turned on. Only the GSuite
+	// directory knows this, so with any other directory everyone is refused.
+	Require2SV bool `json:"require_2sv"`
+}
+
+// Policy encapsulates the policy deciding who can assume which role
+type Policy struct {
+	// Path to the YAML policy file. If empty, users can assume every role
+	// they're entitled to.
+	Path string `json:"path"`
 }
 
 // Server encapsulates all server configs
 type Server struct {
 	Port        int    `json:"port"`
 	Environment string `json:"environment"`
+	// Key the browser login cookies are signed with. Must be shared by every
+	// instance behind a load balancer. If empty, a random one is generated at
+	// startup.
+	CookieSecret string `json:"cookie_secret"`
+	// Bearer token for the admin endpoints. If empty, they're turned off.
+	AdminToken string `json:"admin_token"`
 }
 
 // Initialize configs
@@ -81,21 +222,147 @@ func Get() *Config {
 				ServiceAccountPath:              gocfg.Get("gsuite", "service", "account", "path").String(""),
 				ServiceAccountEmail:             gocfg.Get("gsuite", "service", "account", "email").String(""),
 				ImpersonationEmail:              gocfg.Get("gsuite", "impersonation", "email").String(""),
+				GroupRoles:                      parseGroupRoles(gocfg.Get("gsuite", "group", "roles").String("")),
+			},
+			Directory: Directory{
+				Provider:       gocfg.Get("directory", "provider").String(DirectoryProviderGSuite),
+				Path:           gocfg.Get("directory", "path").String(""),
+				ReloadInterval: gocfg.Get("directory", "reload", "interval").Duration(10 * time.Second),
+				LDAP: LDAP{
+					URL:                gocfg.Get("ldap", "url").String(""),
+					StartTLS:           gocfg.Get("ldap", "start", "tls").Bool(false),
+					CAFile:             gocfg.Get("ldap", "ca", "file").String(""),
+					InsecureSkipVerify: gocfg.Get("ldap", "insecure", "skip", "verify").Bool(false),
+					BindDN:             gocfg.Get("ldap", "bind", "dn").String(""),
+					BindPassword:       gocfg.Get("ldap", "bind", "password").String(""),
+					BaseDN:             gocfg.Get("ldap", "base", "dn").String(""),
+					UserFilter:         gocfg.Get("ldap", "user", "filter").String("(mail=%s)"),
+					RoleAttribute:      gocfg.Get("ldap", "role", "attribute").String(""),
+					GroupAttribute:     gocfg.Get("ldap", "group", "attribute").String("memberOf"),
+					GroupBaseDN:        gocfg.Get("ldap", "group", "base", "dn").String(""),
+					GroupFilter:        gocfg.Get("ldap", "group", "filter").String("(member=%s)"),
+					GroupRoles:         parseGroupRoles(gocfg.Get("ldap", "group", "roles").String("")),
+					Attributes:         parseMap(gocfg.Get("ldap", "attributes").String("")),
+					PoolSize:           gocfg.Get("ldap", "pool", "size").Int(4),
+				},
+				CacheTTL:         gocfg.Get("directory", "cache", "ttl").Duration(0),
+				CacheNegativeTTL: gocfg.Get("directory", "cache", "negative", "ttl").Duration(0),
 			},
 			OAuth: OAuth{
-				ClientID:     gocfg.Get("oauth", "client", "id").String(""),
-				ClientSecret: gocfg.Get("oauth", "client", "secret").String(""),
-				Scopes:       strings.Split(gocfg.Get("oauth", "scopes").String(""), ","),
-				TokenURL:     gocfg.Get("oauth", "token", "url").String(""),
-				AuthURL:      gocfg.Get("oauth", "auth", "url").String(""),
-				RedirectURL:  gocfg.Get("oauth", "redirect", "url").String(""),
+				Provider:           gocfg.Get("oauth", "provider").String(OAuthProviderGoogle),
+				IssuerURL:          gocfg.Get("oauth", "issuer", "url").String(""),
+				ClientID:           gocfg.Get("oauth", "client", "id").String(""),
+				ClientSecret:       gocfg.Get("oauth", "client", "secret").String(""),
+				Scopes:             strings.Split(gocfg.Get("oauth", "scopes").String(""), ","),
+				TokenURL:           gocfg.Get("oauth", "token", "url").String(""),
+				AuthURL:            gocfg.Get("oauth", "auth", "url").String(""),
+				RedirectURL:        gocfg.Get("oauth", "redirect", "url").String(""),
+				Audiences:          splitList(gocfg.Get("oauth", "audiences").String("")),
+				ClockSkew:          gocfg.Get("oauth", "clock", "skew").Duration(2 * time.Minute),
+				DeviceClientID:     gocfg.Get("oauth", "device", "client", "id").String(""),
+				DeviceClientSecret: gocfg.Get("oauth", "device", "client", "secret").String(""),
+			},
+			Identity: Identity{
+				AllowedHostedDomains: splitList(gocfg.Get("identity", "allowed", "hosted", "domains").String("")),
+				AllowedAudiences:     splitList(gocfg.Get("identity", "allowed", "audiences").String("")),
+				RequireEmailVerified: gocfg.Get("identity", "require", "email", "verified").Bool(true),
+				AllowCredentialFile:  gocfg.Get("identity", "allow", "credential", "file").Bool(true),
+				DenySuspended:        gocfg.Get("identity", "deny", "suspended").Bool(true),
+				DenyArchived:         gocfg.Get("identity", "deny", "archived").Bool(true),
+				Require2SV:           gocfg.Get("identity", "require", "2sv").Bool(false),
+			},
+			Policy: Policy{
+				Path: gocfg.Get("policy", "path").String(""),
+			},
+			AWS: AWS{
+				SessionDuration: SessionDuration{
+					Default: gocfg.Get("aws", "session", "duration", "default").Duration(time.Hour),
+					Max:     gocfg.Get("aws", "session", "duration", "max").Duration(12 * time.Hour),
+					RoleMax: parseDurationMap(gocfg.Get("aws", "session", "duration", "role", "max").String(""), minSessionDuration),
+				},
+				SessionTags:    parseMap(gocfg.Get("aws", "session", "tags").String("")),
+				SourceIdentity: gocfg.Get("aws", "source", "identity").Bool(false),
 			},
 			Server: Server{
-				Port:        gocfg.Get("server", "port").Int(3030),
-				Environment: gocfg.Get("server", "environment").String("development"),
+				Port:         gocfg.Get("server", "port").Int(3030),
+				Environment:  gocfg.Get("server", "environment").String("development"),
+				CookieSecret: gocfg.Get("server", "cookie", "secret").String(""),
+				AdminToken:   gocfg.Get("server", "admin", "token").String(""),
 			},
 		}
+
+		if len(instance.OAuth.Audiences) == 0 {
+			instance.OAuth.Audiences = []string{instance.OAuth.ClientID}
+			if instance.OAuth.DeviceClientID != "" {
+				instance.OAuth.Audiences = append(instance.OAuth.Audiences, instance.OAuth.DeviceClientID)
+			}
+		}
 	})
 
 	return instance
 }
+
+// splitList splits a comma delimited string, dropping any empty entries
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseGroupRoles parses a semicolon delimited list of <group>=<role>.
+// Roles have commas in them, and LDAP DNs have equals signs, so the role is
+// whatever comes after the last equals sign.
+func parseGroupRoles(s string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			logging.Logger().Warn("skipping invalid group role", zap.String("value", pair))
+			continue
+		}
+		m[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return m
+}
+
+// parseMap parses a comma delimited list of <key>=<value> pairs. Pairs that
+// don't parse are logged and skipped.
+func parseMap(s string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range splitList(s) {
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			logging.Logger().Warn("skipping invalid pair", zap.String("value", pair))
+			continue
+		}
+		m[pair[:i]] = pair[i+1:]
+	}
+	return m
+}
+
+// parseDurationMap parses a comma delimited list of <key>=<duration> pairs.
+// Pairs that don't parse, or are shorter than min, are logged and skipped.
+func parseDurationMap(s string, min time.Duration) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for key, value := range parseMap(s) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			logging.Logger().Warn("skipping invalid duration", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if d < min {
+			logging.Logger().Warn("skipping duration below the minimum", zap.String("key", key), zap.Duration("duration", d), zap.Duration("min", min))
+			continue
+		}
+		durations[key] = d
+	}
+	return durations
+}
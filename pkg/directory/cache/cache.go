@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrLookupPanicked = errors.New("directory lookup panicked")
+)
+
+// Client wraps a directory.Service, caching the users it looks up. Users
+// that aren't found are cached too, for their own TTL, but any other error
+// is passed straight back so a blip in the directory isn't remembered.
+// Concurrent lookups of the same user share one call to the directory.
+type Client struct {
+	next        directory.Service
+	logger      *zap.Logger
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu sync.Mutex
+	// Keyed by lowercased email
+	entries   map[string]*entry
+	calls     map[string]*call
+	lastPrune time.Time
+}
+
+type entry struct {
+	// Nil if the user wasn't found
+	user    *directory.User
+	expires time.Time
+}
+
+// call is a lookup in flight that other callers can wait on
+type call struct {
+	done chan struct{}
+	user *directory.User
+	err  error
+	// Set if the user was invalidated while the lookup was in flight, so its
+	// result isn't cached
+	invalidated bool
+}
+
+// New wraps the directory service in a cache
+func New(next directory.Service, setOpts ...Option) *Client {
+	opts := defaultOptions()
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	return &Client{
+		next:        next,
+		logger:      opts.Logger,
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
+		now:         time.Now,
+		entries:     map[string]*entry{},
+		calls:       map[string]*call{},
+	}
+}
+
+// GetUser returns the cached user, looking them up if they aren't cached or
+// their entry has expired
+func (c *Client) GetUser(email string) (*directory.User, error) {
+	key := strings.ToLower(email)
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		if c.now().Before(e.expires) {
+			c.mu.Unlock()
+			if e.user == nil {
+				return nil, directory.ErrUserNotFound
+			}
+			return e.user.Copy(), nil
+		}
+		delete(c.entries, key)
+	}
+
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		return copyResult(cl.user, cl.err)
+	}
+
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	c.lookup(key, email, cl)
+	return copyResult(cl.user, cl.err)
+}
+
+// lookup asks the directory for the user, caching the result and handing it
+// to anyone waiting on the call
+func (c *Client) lookup(key, email string, cl *call) {
+	// Waiters are released even if the directory panics
+	cl.err = ErrLookupPanicked
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		if !cl.invalidated {
+			c.store(key, cl.user, cl.err)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	cl.user, cl.err = c.next.GetUser(email)
+}
+
+// Invalidate drops the user from the cache, so the next lookup goes to the
+// directory. It reports whether the user was cached.
+func (c *Client) Invalidate(email string) bool {
+	key := strings.ToLower(email)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A lookup in flight may have read the user from before the change
+	if cl, ok := c.calls[key]; ok {
+		cl.invalidated = true
+	}
+
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+
+	c.logger.Info("invalidated cached user", zap.String("email", email), zap.Bool("cached", ok))
+	return ok
+}
+
+// store caches the result of a lookup. Must be called with the lock held.
+func (c *Client) store(key string, user *directory.User, err error) {
+	now := c.now()
+	c.prune(now)
+
+	switch {
+	case err == nil && user != nil && c.ttl > 0:
+		c.entries[key] = &entry{user: user, expires: now.Add(c.ttl)}
+	case err == directory.ErrUserNotFound && c.negativeTTL > 0:
+		c.entries[key] = &entry{expires: now.Add(c.negativeTTL)}
+	}
+}
+
+// prune drops expired entries, so users who stop logging in don't stay in
+// memory forever. It only sweeps once per TTL. Must be called with the lock
+// held.
+func (c *Client) prune(now time.Time) {
+	interval := c.ttl
+	if c.negativeTTL > interval {
+		interval = c.negativeTTL
+	}
+	if now.Sub(c.lastPrune) < interval {
+		return
+	}
+	c.lastPrune = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// copyResult gives each caller their own copy of the user, since they're
+// shared with the cache and anyone else who waited on the lookup
+func copyResult(user *directory.User, err error) (*directory.User, error) {
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return user.Copy(), nil
+}
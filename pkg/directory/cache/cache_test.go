@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+)
+
+// fakeDirectory knows alice, and counts how often it's asked about anyone
+type fakeDirectory struct {
+	mu    sync.Mutex
+	calls map[string]int
+	// If set, lookups wait for it to be closed
+	gate chan struct{}
+	err  error
+}
+
+func (f *fakeDirectory) GetUser(email string) (*directory.User, error) {
+	email = strings.ToLower(email)
+	f.mu.Lock()
+	f.calls[email]++
+	gate, err := f.gate, f.err
+	f.mu.Unlock()
+
+	if gate != nil {
+		<-gate
+	}
+	if err != nil {
+		return nil, err
+	}
+	if email != "alice@example.com" {
+		return nil, directory.ErrUserNotFound
+	}
+	return &directory.User{
+		Email:      email,
+		Roles:      []directory.Role{{ARN: "arn:aws:iam::111111111111:role/admin"}},
+		Attributes: map[string]string{},
+	}, nil
+}
+
+func (f *fakeDirectory) callCount(email string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[strings.ToLower(email)]
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestClient(f *fakeDirectory) (*Client, *clock) {
+	clk := &clock{now: time.Unix(0, 0)}
+	c := New(f, WithLogger(zap.NewNop()), WithTTL(time.Minute), WithNegativeTTL(10*time.Second))
+	c.now = clk.Now
+	return c, clk
+}
+
+func TestGetUser(t *testing.T) {
+	f := &fakeDirectory{calls: map[string]int{}}
+	c, clk := newTestClient(f)
+
+	testCases := []struct {
+		email         string
+		advance       time.Duration
+		expectedErr   error
+		expectedCalls int
+	}{
+		{email: "alice@example.com", expectedCalls: 1},
+		// Cached, whatever the case of the email
+		{email: "Alice@example.com", advance: 59 * time.Second, expectedCalls: 1},
+		{email: "alice@example.com", advance: time.Second, expectedCalls: 2},
+		{email: "bob@example.com", expectedErr: directory.ErrUserNotFound, expectedCalls: 1},
+		{email: "bob@example.com", advance: 9 * time.Second, expectedErr: directory.ErrUserNotFound, expectedCalls: 1},
+		{email: "bob@example.com", advance: time.Second, expectedErr: directory.ErrUserNotFound, expectedCalls: 2},
+	}
+
+	for i, tc := range testCases {
+		clk.now = clk.now.Add(tc.advance)
+		user, err := c.GetUser(tc.email)
+		if err != tc.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, tc.expectedErr, err)
+		}
+		if err == nil && user.Email != "alice@example.com" {
+			t.Errorf("[%d] - Expected alice, got %+v", i, user)
+		}
+		if calls := f.callCount(tc.email); calls != tc.expectedCalls {
+			t.Errorf("[%d] - Expected %d calls to the directory, got %d", i, tc.expectedCalls, calls)
+		}
+	}
+
+	// Callers can't change what's cached
+	user, _ := c.GetUser("alice@example.com")
+	user.Roles[0].ARN = "changed"
+	if user, _ := c.GetUser("alice@example.com"); user.Roles[0].ARN == "changed" {
+		t.Errorf("Expected the cached user to be unchanged")
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	f := &fakeDirectory{calls: map[string]int{}, err: errors.New("quota exceeded")}
+	c, _ := newTestClient(f)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetUser("alice@example.com"); err != f.err {
+			t.Errorf("[%d] - Expected %v, got %v", i, f.err, err)
+		}
+	}
+	if calls := f.callCount("alice@example.com"); calls != 2 {
+		t.Errorf("Expected every lookup to go to the directory, got %d calls", calls)
+	}
+}
+
+func TestConcurrentLookups(t *testing.T) {
+	f := &fakeDirectory{calls: map[string]int{}, gate: make(chan struct{})}
+	c, _ := newTestClient(f)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.GetUser("alice@example.com")
+			errs <- err
+		}()
+	}
+
+	// Let the lookups pile up behind the first one
+	for f.callCount("alice@example.com") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(f.gate)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+	if calls := f.callCount("alice@example.com"); calls != 1 {
+		t.Errorf("Expected one call to the directory, got %d", calls)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	f := &fakeDirectory{calls: map[string]int{}}
+	c, _ := newTestClient(f)
+
+	if c.Invalidate("alice@example.com") {
+		t.Errorf("Expected alice not to be cached yet")
+	}
+
+	c.GetUser("alice@example.com")
+	if !c.Invalidate("ALICE@example.com") {
+		t.Errorf("Expected alice to be cached")
+	}
+
+	c.GetUser("alice@example.com")
+	if calls := f.callCount("alice@example.com"); calls != 2 {
+		t.Errorf("Expected alice to be looked up again, got %d calls", calls)
+	}
+
+	// A lookup that was in flight when the user was invalidated isn't cached
+	c.Invalidate("alice@example.com")
+	f.mu.Lock()
+	f.gate = make(chan struct{})
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.GetUser("alice@example.com")
+		close(done)
+	}()
+	for f.callCount("alice@example.com") == 2 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Invalidate("alice@example.com")
+	close(f.gate)
+	<-done
+
+	f.mu.Lock()
+	f.gate = nil
+	f.mu.Unlock()
+	c.GetUser("alice@example.com")
+	if calls := f.callCount("alice@example.com"); calls != 4 {
+		t.Errorf("Expected the invalidated lookup not to be cached, got %d calls", calls)
+	}
+}
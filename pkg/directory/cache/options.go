@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Options contains all cache options
+type Options struct {
+	Logger *zap.Logger
+	// How long users are cached for. Zero doesn't cache them.
+	TTL time.Duration
+	// How long users that weren't found are cached for. Zero doesn't cache
+	// them.
+	NegativeTTL time.Duration
+}
+
+// Option is a functional way of setting options for the cache
+type Option func(o *Options)
+
+// WithLogger sets the logger
+func WithLogger(l *zap.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithTTL sets how long users are cached for
+func WithTTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = d
+	}
+}
+
+// WithNegativeTTL sets how long users that weren't found are cached for
+func WithNegativeTTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.NegativeTTL = d
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Logger:      logging.Logger(),
+		TTL:         5 * time.Minute,
+		NegativeTTL: 30 * time.Second,
+	}
+}
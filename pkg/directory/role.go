@@ -0,0 +1,56 @@
+package directory
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidRole = errors.New("role must be a comma delimited role ARN and SAML provider ARN")
+)
+
+// Role is an IAM role a user can assume, along with the SAML provider the
+// role trusts
+type Role struct {
+	ARN         string
+	ProviderARN string
+}
+
+// ParseRole parses a role in the format AWS expects in SAML assertions,
+// which is the role ARN and provider ARN separated by a comma. AWS accepts
+// the pair in either order, so we do too.
+func ParseRole(value string) (Role, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return Role{}, ErrInvalidRole
+	}
+
+	roleARN := strings.TrimSpace(parts[0])
+	providerARN := strings.TrimSpace(parts[1])
+	if strings.Contains(roleARN, ":saml-provider/") {
+		roleARN, providerARN = providerARN, roleARN
+	}
+
+	if !isARN(roleARN, ":role/") || !isARN(providerARN, ":saml-provider/") {
+		return Role{}, ErrInvalidRole
+	}
+
+	return Role{
+		ARN:         roleARN,
+		ProviderARN: providerARN,
+	}, nil
+}
+
+// Name is the role's name without the path, which doubles as its alias
+func (r Role) Name() string {
+	return r.ARN[strings.LastIndex(r.ARN, "/")+1:]
+}
+
+// Matches checks whether the ARN or alias refers to this role
+func (r Role) Matches(id string) bool {
+	return id == r.ARN || id == r.Name()
+}
+
+func isARN(arn, resource string) bool {
+	return strings.HasPrefix(arn, "arn:aws") && strings.Contains(arn, resource)
+}
@@ -0,0 +1,98 @@
+package directory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRole(t *testing.T) {
+	expected := Role{
+		ARN:         "arn:aws:iam::123456789012:role/admin",
+		ProviderARN: "arn:aws:iam::123456789012:saml-provider/GSuite",
+	}
+
+	testCases := []struct {
+		value     string
+		expected  Role
+		expectErr bool
+	}{
+		// Role first, as documented by AWS
+		{
+			value:    "arn:aws:iam::123456789012:role/admin,arn:aws:iam::123456789012:saml-provider/GSuite",
+			expected: expected,
+		},
+		// Provider first is also accepted
+		{
+			value:    "arn:aws:iam::123456789012:saml-provider/GSuite, arn:aws:iam::123456789012:role/admin",
+			expected: expected,
+		},
+		// Missing provider
+		{
+			value:     "arn:aws:iam::123456789012:role/admin",
+			expectErr: true,
+		},
+		// Not ARNs
+		{
+			value:     "admin,GSuite",
+			expectErr: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		role, err := ParseRole(testCase.value)
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("[%d] - Expected error: %t, got %v\n", i, testCase.expectErr, err)
+		}
+
+		if !reflect.DeepEqual(role, testCase.expected) {
+			t.Errorf("[%d] - Expected %+v, got %+v\n", i, testCase.expected, role)
+		}
+	}
+}
+
+func TestFindRole(t *testing.T) {
+	user := &User{
+		Roles: []Role{
+			{ARN: "arn:aws:iam::111111111111:role/admin"},
+			{ARN: "arn:aws:iam::222222222222:role/admin"},
+			{ARN: "arn:aws:iam::222222222222:role/path/readonly"},
+		},
+	}
+
+	testCases := []struct {
+		id          string
+		expectedARN string
+		expectedErr error
+	}{
+		{
+			id:          "arn:aws:iam::111111111111:role/admin",
+			expectedARN: "arn:aws:iam::111111111111:role/admin",
+		},
+		// Alias ignores the role path
+		{
+			id:          "readonly",
+			expectedARN: "arn:aws:iam::222222222222:role/path/readonly",
+		},
+		// Alias exists in both accounts
+		{
+			id:          "admin",
+			expectedErr: ErrRoleAmbiguous,
+		},
+		{
+			id:          "arn:aws:iam::333333333333:role/admin",
+			expectedErr: ErrRoleNotEntitled,
+		},
+	}
+
+	for i, testCase := range testCases {
+		role, err := user.FindRole(testCase.id)
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v\n", i, testCase.expectedErr, err)
+			continue
+		}
+
+		if err == nil && role.ARN != testCase.expectedARN {
+			t.Errorf("[%d] - Expected %s, got %s\n", i, testCase.expectedARN, role.ARN)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package directory
 
-// Service is an interface that implements getting a user
+// Service is an interface that implements getting a user. Users that don't
+// exist are reported with ErrUserNotFound.
 type Service interface {
 	GetUser(email string) (*User, error)
 }
+
+// Invalidator is implemented by services that cache users, so that a change
+// to a user can be picked up before their entry expires
+type Invalidator interface {
+	// Invalidate drops the user from the cache, reporting whether they were in it
+	Invalidate(email string) bool
+}
@@ -1,8 +1,72 @@
 package directory
 
+import (
+	"errors"
+	"time"
+)
+
+// Well known keys in a user's attributes
+const (
+	AttributeDepartment  = "department"
+	AttributeCostCenter  = "cost_center"
+	AttributeOrgUnitPath = "org_unit_path"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found in directory")
+	ErrRoleNotEntitled = errors.New("user is not entitled to role")
+	ErrRoleAmbiguous   = errors.New("role alias matches more than one role")
+)
+
 // User encapsulates a user's identifying email and their custom attributes
 type User struct {
 	Email string
-	// Identifier for a credential
-	CredentialID string
+	// Roles the user is entitled to assume
+	Roles []Role
+	// Groups the user is a member of, directly or through nested groups
+	Groups []string
+	// How long the user's sessions should last. Zero if not set.
+	SessionDuration time.Duration
+	// Other directory fields describing the user, such as their department
+	Attributes map[string]string
+	// Account state, for directories that have it
+	Suspended bool
+	Archived  bool
+	// Whether the user has turned on 2-Step Verification, and whether their
+	// domain requires it
+	EnrolledIn2SV bool
+	EnforcedIn2SV bool
+}
+
+// Copy returns a copy of the user that shares nothing with the original
+func (u *User) Copy() *User {
+	copied := *u
+	copied.Roles = append([]Role{}, u.Roles...)
+	copied.Groups = append([]string{}, u.Groups...)
+	copied.Attributes = map[string]string{}
+	for k, v := range u.Attributes {
+		copied.Attributes[k] = v
+	}
+	return &copied
+}
+
+// FindRole looks up one of the user's roles by its ARN or alias
+func (u *User) FindRole(id string) (*Role, error) {
+	var found *Role
+	for i := range u.Roles {
+		if !u.Roles[i].Matches(id) {
+			continue
+		}
+
+		// The same role name can exist in more than one account
+		if found != nil {
+			return nil, ErrRoleAmbiguous
+		}
+		found = &u.Roles[i]
+	}
+
+	if found == nil {
+		return nil, ErrRoleNotEntitled
+	}
+	return found, nil
 }
@@ -2,7 +2,8 @@ package directory
 
 // Attributes wraps the custom attributes for a directory user
 type Attributes struct {
-	IAMRole         []IAMRole
+	IAMRole []IAMRole
+	// Session duration in seconds
 	SessionDuration string
 }
 
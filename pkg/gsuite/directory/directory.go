@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 )
 
 const (
 	awsSamlKey   = "AWS_SAML"
 	defaultScope = "https://www.googleapis.com/auth/admin.directory.user"
+	groupScope   = "https://www.googleapis.com/auth/admin.directory.group"
 )
 
 var (
@@ -27,6 +33,11 @@ var (
 type Client struct {
 	service *admin.Service
 	logger  *zap.Logger
+	// Keyed by lowercased group email
+	groupRoles map[string]directory.Role
+	// Whether to look up groups even when they don't grant roles
+	lookupGroups bool
+	listGroups   groupLister
 }
 
 // NewClient creates a new version of Client.
@@ -42,16 +53,28 @@ func NewClient(setOpts ...Option) (*Client, error) {
 		return nil, err
 	}
 
-	// TODO: Add real scope here
-	service, err := serviceClient(opts.ImpersonationEmail, opts.ServiceAccountPEM, []string{defaultScope, "https://www.googleapis.com/auth/admin.directory.group"})
+	groupRoles := map[string]directory.Role{}
+	for group, value := range opts.GroupRoles {
+		role, err := directory.ParseRole(value)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %s", group, err)
+		}
+		groupRoles[strings.ToLower(group)] = role
+	}
+
+	service, err := serviceClient(opts.ImpersonationEmail, opts.ServiceAccountPEM, []string{defaultScope, groupScope})
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		logger:  opts.Logger,
-		service: service,
-	}, nil
+	client := &Client{
+		logger:       opts.Logger,
+		service:      service,
+		groupRoles:   groupRoles,
+		lookupGroups: opts.LookupGroups,
+	}
+	client.listGroups = client.directGroups
+	return client, nil
 }
 
 // GetUser find a user by email
@@ -60,32 +83,54 @@ func (c *Client) GetUser(email string) (*directory.User, error) {
 	user, err := userSvc.Get(email).Projection("full").Do()
 	if err != nil {
 		c.logger.Error("error getting user", zap.Error(err))
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+			return nil, directory.ErrUserNotFound
+		}
 		return nil, err
 	}
 
+	// Users can get all their roles through groups, so the attribute is optional
 	awsSamlInfo := &Attributes{}
-	awsSamlInfoRaw, ok := user.CustomSchemas[awsSamlKey]
-	if !ok {
-		c.logger.Error("error attribute role info not found on user")
-		return nil, ErrRoleNotSet
+	if awsSamlInfoRaw, ok := user.CustomSchemas[awsSamlKey]; ok {
+		awsSamlInfoBytes, err := awsSamlInfoRaw.MarshalJSON()
+		if err != nil {
+			c.logger.Error("error marshalling raw JSON")
+			return nil, err
+		}
+
+		err = json.Unmarshal(awsSamlInfoBytes, awsSamlInfo)
+		if err != nil {
+			c.logger.Error("error unmarshalling json", zap.Error(err))
+			return nil, err
+		}
 	}
 
-	awsSamlInfoBytes, err := awsSamlInfoRaw.MarshalJSON()
-	if err != nil {
-		c.logger.Error("error marshalling raw JSON")
-		return nil, err
+	// Don't spend API calls walking groups when nothing needs them
+	groups := []string{}
+	if c.lookupGroups || len(c.groupRoles) > 0 {
+		groups, err = expandGroups(user.PrimaryEmail, c.listGroups)
+		if err != nil {
+			c.logger.Error("error getting user's groups", zap.String("email", email), zap.Error(err))
+			return nil, err
+		}
 	}
 
-	err = json.Unmarshal(awsSamlInfoBytes, awsSamlInfo)
-	if err != nil {
-		c.logger.Error("error unmarshalling json", zap.Error(err))
-		return nil, err
+	roles := c.getRoles(awsSamlInfo, groups)
+	if len(roles) == 0 {
+		c.logger.Error("error no valid roles set on user", zap.String("email", email))
+		return nil, ErrRoleNotSet
 	}
 
-	// TODO: Custom attributes to get mapped role arns
 	return &directory.User{
-		Email:        user.PrimaryEmail,
-		CredentialID: getRole(awsSamlInfo),
+		Email:           user.PrimaryEmail,
+		Roles:           roles,
+		Groups:          groups,
+		SessionDuration: c.getSessionDuration(awsSamlInfo),
+		Attributes:      c.getAttributes(user),
+		Suspended:       user.Suspended,
+		Archived:        user.Archived,
+		EnrolledIn2SV:   user.IsEnrolledIn2Sv,
+		EnforcedIn2SV:   user.IsEnforcedIn2Sv,
 	}, nil
 }
 
@@ -112,8 +157,90 @@ func serviceClient(email string, credentials []byte, scopes []string) (*admin.Se
 	return admin.New(config.Client(context.Background()))
 }
 
-// TODO: Also get the session duration
-func getRole(attributes *Attributes) string {
-	roleInfo := strings.Split(attributes.IAMRole[0].Value, ",")
-	return roleInfo[0]
+// getRoles combines the roles set on the user with the roles granted to
+// their groups. A role granted more than once is only listed once.
+func (c *Client) getRoles(attributes *Attributes, groups []string) []directory.Role {
+	roles := []directory.Role{}
+	seen := map[string]bool{}
+	add := func(role directory.Role) {
+		if !seen[role.ARN] {
+			seen[role.ARN] = true
+			roles = append(roles, role)
+		}
+	}
+
+	for _, iamRole := range attributes.IAMRole {
+		role, err := directory.ParseRole(iamRole.Value)
+		if err != nil {
+			// One bad value shouldn't lock the user out of their other roles
+			c.logger.Warn("skipping invalid role", zap.String("value", iamRole.Value), zap.Error(err))
+			continue
+		}
+		add(role)
+	}
+
+	for _, group := range groups {
+		if role, ok := c.groupRoles[strings.ToLower(group)]; ok {
+			add(role)
+		}
+	}
+
+	return roles
+}
+
+// The session duration attribute is set in seconds, same as the SAML attribute
+func (c *Client) getSessionDuration(attributes *Attributes) time.Duration {
+	if attributes.SessionDuration == "" {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(attributes.SessionDuration)
+	if err != nil || seconds <= 0 {
+		c.logger.Warn("ignoring invalid session duration", zap.String("value", attributes.SessionDuration))
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func (c *Client) getAttributes(user *admin.User) map[string]string {
+	attributes := map[string]string{}
+	if user.OrgUnitPath != "" {
+		attributes[directory.AttributeOrgUnitPath] = user.OrgUnitPath
+	}
+
+	// Organizations come back untyped, so round trip them through JSON
+	orgsBytes, err := json.Marshal(user.Organizations)
+	if err != nil {
+		c.logger.Warn("error marshalling organizations", zap.Error(err))
+		return attributes
+	}
+
+	orgs := []admin.UserOrganization{}
+	if err := json.Unmarshal(orgsBytes, &orgs); err != nil {
+		c.logger.Warn("error unmarshalling organizations", zap.Error(err))
+		return attributes
+	}
+
+	if len(orgs) == 0 {
+		return attributes
+	}
+
+	// Use the primary organization, falling back to the first one
+	org := orgs[0]
+	for _, o := range orgs {
+		if o.Primary {
+			org = o
+			break
+		}
+	}
+
+	if org.Department != "" {
+		attributes[directory.AttributeDepartment] = org.Department
+	}
+	if org.CostCenter != "" {
+		attributes[directory.AttributeCostCenter] = org.CostCenter
+	}
+
+	return attributes
 }
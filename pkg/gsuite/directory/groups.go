@@ -0,0 +1,61 @@
+package directory
+
+import (
+	"context"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// groupLister lists the emails of the groups a user or group is directly
+// a member of
+type groupLister func(key string) ([]string, error)
+
+// directGroups asks the Directory API which groups the user or group is
+// directly a member of
+func (c *Client) directGroups(key string) ([]string, error) {
+	groups := []string{}
+	err := admin.NewGroupsService(c.service).List().UserKey(key).Pages(context.Background(), func(page *admin.Groups) error {
+		for _, group := range page.Groups {
+			groups = append(groups, group.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// expandGroups returns every group the user is in, whether directly or
+// through groups nested in other groups. The API only returns direct
+// memberships, so it walks up from the user's groups to the groups those
+// are in. Emails are lowercased, and groups that nest in a loop are only
+// visited once.
+func expandGroups(email string, list groupLister) ([]string, error) {
+	groups := []string{}
+	seen := map[string]bool{}
+	queue := []string{email}
+
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+
+		parents, err := list(key)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parent := range parents {
+			parent = strings.ToLower(parent)
+			if seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			groups = append(groups, parent)
+			queue = append(queue, parent)
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,125 @@
+package directory
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+)
+
+// memberships maps a user or group to the groups it's directly in
+type memberships map[string][]string
+
+func (m memberships) list(key string) ([]string, error) {
+	if key == "broken@example.com" {
+		return nil, errors.New("backend error")
+	}
+	return m[key], nil
+}
+
+func TestExpandGroups(t *testing.T) {
+	m := memberships{
+		"alice@example.com":  {"eng@example.com", "Oncall@Example.com"},
+		"eng@example.com":    {"aws-dev@example.com"},
+		"oncall@example.com": {"aws-prod-readonly@example.com", "eng@example.com"},
+		// Groups can nest in a loop
+		"aws-dev@example.com": {"eng@example.com"},
+		"bob@example.com":     {"broken@example.com"},
+	}
+
+	testCases := []struct {
+		email     string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			email:    "alice@example.com",
+			expected: []string{"aws-dev@example.com", "aws-prod-readonly@example.com", "eng@example.com", "oncall@example.com"},
+		},
+		{
+			email:    "carol@example.com",
+			expected: []string{},
+		},
+		// Partial group lists could silently drop roles, so errors fail the lookup
+		{
+			email:     "bob@example.com",
+			expectErr: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		groups, err := expandGroups(tc.email, m.list)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("[%d] - Expected error, got %v", i, groups)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] - Expected no error, got %v", i, err)
+			continue
+		}
+
+		sort.Strings(groups)
+		if !reflect.DeepEqual(groups, tc.expected) {
+			t.Errorf("[%d] - Expected %v, got %v", i, tc.expected, groups)
+		}
+	}
+}
+
+func TestGetRoles(t *testing.T) {
+	admin := directory.Role{
+		ARN:         "arn:aws:iam::111111111111:role/admin",
+		ProviderARN: "arn:aws:iam::111111111111:saml-provider/GSuite",
+	}
+	readonly := directory.Role{
+		ARN:         "arn:aws:iam::111111111111:role/readonly",
+		ProviderARN: "arn:aws:iam::111111111111:saml-provider/GSuite",
+	}
+
+	c := &Client{
+		logger: zap.NewNop(),
+		groupRoles: map[string]directory.Role{
+			"aws-admin@example.com":         admin,
+			"aws-prod-readonly@example.com": readonly,
+		},
+	}
+
+	testCases := []struct {
+		attributes *Attributes
+		groups     []string
+		expected   []directory.Role
+	}{
+		// Roles set on the user still count
+		{
+			attributes: &Attributes{IAMRole: []IAMRole{{Value: admin.ARN + "," + admin.ProviderARN}}},
+			expected:   []directory.Role{admin},
+		},
+		{
+			attributes: &Attributes{},
+			groups:     []string{"eng@example.com", "AWS-Prod-Readonly@example.com"},
+			expected:   []directory.Role{readonly},
+		},
+		// Granted both ways, the role is only listed once
+		{
+			attributes: &Attributes{IAMRole: []IAMRole{{Value: admin.ARN + "," + admin.ProviderARN}, {Value: "garbage"}}},
+			groups:     []string{"aws-admin@example.com", "aws-prod-readonly@example.com"},
+			expected:   []directory.Role{admin, readonly},
+		},
+		{
+			attributes: &Attributes{},
+			groups:     []string{"eng@example.com"},
+			expected:   []directory.Role{},
+		},
+	}
+
+	for i, tc := range testCases {
+		roles := c.getRoles(tc.attributes, tc.groups)
+		if !reflect.DeepEqual(roles, tc.expected) {
+			t.Errorf("[%d] - Expected %v, got %v", i, tc.expected, roles)
+		}
+	}
+}
@@ -15,6 +15,12 @@ type Options struct {
 	ServiceAccountEmail string
 	ServiceAccountPEM   []byte
 	Scopes              []string
+	// Roles granted to members of a group, keyed by the group's email. Values
+	// are <role arn>,<provider arn>.
+	GroupRoles map[string]string
+	// Look up the user's groups even if no group roles are set, for when
+	// something else, like a policy, matches on them
+	LookupGroups bool
 }
 
 // Option ...
@@ -57,6 +63,21 @@ func WithServiceAccountEmail(email string) Option {
 	}
 }
 
+// WithGroupRoles sets the roles granted to members of each group, including
+// members of groups nested inside it
+func WithGroupRoles(groupRoles map[string]string) Option {
+	return func(o *Options) {
+		o.GroupRoles = groupRoles
+	}
+}
+
+// WithGroupLookup sets whether users' groups are always looked up
+func WithGroupLookup(lookup bool) Option {
+	return func(o *Options) {
+		o.LookupGroups = lookup
+	}
+}
+
 // WithLogger sets the logger on the Option
 func WithLogger(l *zap.Logger) Option {
 	return func(o *Options) {
@@ -0,0 +1,194 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	oauth2 "golang.org/x/oauth2"
+)
+
+const (
+	// Google's device authorization endpoint
+	// https://developers.google.com/identity/protocols/oauth2/limited-input-device
+	googleDeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// Used when the provider doesn't say how often to poll
+	defaultDeviceInterval = 5 * time.Second
+	// How much to back off by when told to slow down
+	slowDownIncrement = 5 * time.Second
+)
+
+var (
+	ErrDeviceFlowUnsupported = errors.New("provider does not support the device flow")
+	ErrDeviceCodeExpired     = errors.New("device code expired before the user logged in")
+	ErrDeviceAccessDenied    = errors.New("user denied access")
+)
+
+// DeviceCode is what the user needs to finish logging in on another device
+type DeviceCode struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	// Google calls it a URL, RFC 8628 calls it a URI
+	VerificationURL string `json:"verification_url"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// URL returns where the user should go to enter the code
+func (d *DeviceCode) URL() string {
+	if d.VerificationURI != "" {
+		return d.VerificationURI
+	}
+	return d.VerificationURL
+}
+
+// DeviceFlow runs the OAuth device authorization grant, for logging in where
+// there's no browser, like over SSH
+// https://tools.ietf.org/html/rfc8628
+type DeviceFlow struct {
+	provider *oauth.Provider
+	client   *http.Client
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewDeviceFlow creates a DeviceFlow against the provider's endpoints
+func NewDeviceFlow(provider *oauth.Provider, client *http.Client) *DeviceFlow {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &DeviceFlow{
+		provider: provider,
+		client:   client,
+		now:      time.Now,
+		sleep:    sleep,
+	}
+}
+
+// Start asks the provider for a code for the user to enter
+func (f *DeviceFlow) Start(ctx context.Context) (*DeviceCode, error) {
+	if f.provider.DeviceAuthURL == "" || f.provider.ClientID == "" {
+		return nil, ErrDeviceFlowUnsupported
+	}
+
+	v := url.Values{}
+	v.Set("client_id", f.provider.ClientID)
+	v.Set("scope", strings.Join(f.provider.Scopes, " "))
+
+	code := &DeviceCode{}
+	status, body, err := f.post(ctx, f.provider.DeviceAuthURL, v)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("error requesting device code: %d %s", status, body)
+	}
+
+	if err := json.Unmarshal(body, code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+type deviceTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// Poll waits for the user to log in with the code, polling as often as the
+// provider allows, and returns the tokens issued
+func (f *DeviceFlow) Poll(ctx context.Context, code *DeviceCode) (*oauth2.Token, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+	deadline := f.now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	v := url.Values{}
+	v.Set("client_id", f.provider.ClientID)
+	v.Set("client_secret", f.provider.ClientSecret)
+	v.Set("device_code", code.DeviceCode)
+	v.Set("grant_type", deviceCodeGrantType)
+
+	for {
+		if err := f.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+		if f.now().After(deadline) {
+			return nil, ErrDeviceCodeExpired
+		}
+
+		_, body, err := f.post(ctx, f.provider.TokenURL, v)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &deviceTokenResponse{}
+		if err := json.Unmarshal(body, resp); err != nil {
+			return nil, err
+		}
+
+		switch resp.Error {
+		case "":
+			token := &oauth2.Token{
+				AccessToken:  resp.AccessToken,
+				TokenType:    resp.TokenType,
+				RefreshToken: resp.RefreshToken,
+			}
+			if resp.ExpiresIn > 0 {
+				token.Expiry = f.now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+			}
+			return token.WithExtra(map[string]interface{}{"id_token": resp.IDToken}), nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += slowDownIncrement
+		case "expired_token":
+			return nil, ErrDeviceCodeExpired
+		case "access_denied":
+			return nil, ErrDeviceAccessDenied
+		default:
+			return nil, fmt.Errorf("error polling for device token: %s", resp.Error)
+		}
+	}
+}
+
+func (f *DeviceFlow) post(ctx context.Context, endpoint string, v url.Values) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
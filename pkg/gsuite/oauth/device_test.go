@@ -0,0 +1,132 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+)
+
+// fakeDeviceProvider answers token polls with the responses it's given, in
+// order
+type fakeDeviceProvider struct {
+	responses []map[string]interface{}
+	polls     int
+}
+
+func (p *fakeDeviceProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	w.Header().Set("Content-Type", "application/json")
+
+	switch req.URL.Path {
+	case "/device/code":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "device",
+			"user_code":        "ABCD-EFGH",
+			"verification_url": "https://www.google.com/device",
+			"expires_in":       60,
+			"interval":         5,
+		})
+	case "/token":
+		if req.Form.Get("grant_type") != deviceCodeGrantType || req.Form.Get("device_code") != "device" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		resp := p.responses[p.polls]
+		p.polls++
+		if _, ok := resp["error"]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	pending := map[string]interface{}{"error": "authorization_pending"}
+	slowDown := map[string]interface{}{"error": "slow_down"}
+	success := map[string]interface{}{"access_token": "access", "refresh_token": "refresh", "id_token": "id", "expires_in": 3600}
+
+	testCases := []struct {
+		responses         []map[string]interface{}
+		expectedErr       error
+		expectedIntervals []time.Duration
+	}{
+		// Keeps polling while pending, and backs off when told to slow down
+		{
+			responses:         []map[string]interface{}{pending, slowDown, pending, success},
+			expectedIntervals: []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			responses:         []map[string]interface{}{pending, {"error": "expired_token"}},
+			expectedErr:       ErrDeviceCodeExpired,
+			expectedIntervals: []time.Duration{5 * time.Second, 5 * time.Second},
+		},
+		{
+			responses:         []map[string]interface{}{{"error": "access_denied"}},
+			expectedErr:       ErrDeviceAccessDenied,
+			expectedIntervals: []time.Duration{5 * time.Second},
+		},
+		// Gives up once the code's expired, even if the provider doesn't say so
+		{
+			responses:         []map[string]interface{}{slowDown, slowDown, slowDown, slowDown, slowDown},
+			expectedErr:       ErrDeviceCodeExpired,
+			expectedIntervals: []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second, 20 * time.Second, 25 * time.Second},
+		},
+	}
+
+	for i, testCase := range testCases {
+		provider := &fakeDeviceProvider{responses: testCase.responses}
+		ts := httptest.NewServer(provider)
+
+		flow := NewDeviceFlow(&oauth.Provider{
+			TokenURL:      ts.URL + "/token",
+			DeviceAuthURL: ts.URL + "/device/code",
+			ClientID:      "client",
+			Scopes:        []string{"openid", "email"},
+		}, nil)
+
+		now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+		intervals := []time.Duration{}
+		flow.now = func() time.Time { return now }
+		flow.sleep = func(ctx context.Context, d time.Duration) error {
+			intervals = append(intervals, d)
+			now = now.Add(d)
+			return nil
+		}
+
+		code, err := flow.Start(context.Background())
+		if err != nil {
+			t.Fatalf("[%d] - Unexpected error: %v", i, err)
+		}
+		if code.UserCode != "ABCD-EFGH" || code.URL() != "https://www.google.com/device" {
+			t.Errorf("[%d] - Unexpected device code %+v", i, code)
+		}
+
+		token, err := flow.Poll(context.Background(), code)
+		ts.Close()
+
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+		}
+		if err == nil && (token.RefreshToken != "refresh" || token.Extra("id_token") != "id") {
+			t.Errorf("[%d] - Expected the provider's tokens, got %+v", i, token)
+		}
+		if !reflect.DeepEqual(intervals, testCase.expectedIntervals) {
+			t.Errorf("[%d] - Expected intervals %v, got %v", i, testCase.expectedIntervals, intervals)
+		}
+	}
+}
+
+func TestDeviceFlowUnsupported(t *testing.T) {
+	flow := NewDeviceFlow(&oauth.Provider{TokenURL: "https://example.com/token"}, nil)
+
+	if _, err := flow.Start(context.Background()); err != ErrDeviceFlowUnsupported {
+		t.Errorf("Expected ErrDeviceFlowUnsupported, got %v", err)
+	}
+}
@@ -2,7 +2,7 @@ package oauth
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"net/url"
 
@@ -13,13 +13,30 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
+const (
+	// Google publishes the keys it signs ID tokens with here
+	googleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+	googleAuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+)
+
+var (
+	// Google ID tokens come with either form of the issuer
+	googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+	ErrIDTokenNotFound = errors.New("id token not found in token response")
+)
+
 // TODO: Need a way to exchange the refresh token for another access token
 // Client encapsulates all OAuth actions
 type Client struct {
-	client   *http.Client
-	logger   *zap.Logger
-	loginURL string
-	cfg      *oauth2.Config
+	client *http.Client
+	logger *zap.Logger
+	// Built into the login URL on every login
+	oauthCfg       config.OAuth
+	stateGenerator func() string
+	cfg            *oauth2.Config
+	verifier       *oauth.Verifier
+	provider       *oauth.Provider
 }
 
 // NewClient creates a new OAuth client
@@ -31,35 +48,72 @@ func NewClient(setOpts ...Option) *Client {
 	}
 
 	return &Client{
-		client: opts.Client,
-		logger: opts.Logger,
-		cfg:    oauthConf(opts.Config),
-		// TODO: I don't love the reference the global config object, this breaks
-		// the flow of data
-		loginURL: generateOAuthLoginURL(opts.Config),
+		client:         opts.Client,
+		logger:         opts.Logger,
+		oauthCfg:       opts.Config,
+		stateGenerator: opts.Config.StateParameterGenerator,
+		cfg:            oauthConf(opts.Config),
+		verifier: oauth.NewVerifier(
+			oauth.NewKeySet(googleJWKSURL, opts.Client),
+			oauth.WithIssuers(googleIssuers...),
+			oauth.WithAudiences(opts.Config.Audiences...),
+			oauth.WithClockSkew(opts.Config.ClockSkew),
+		),
+		provider: &oauth.Provider{
+			AuthURL:       google.Endpoint.AuthURL,
+			TokenURL:      google.Endpoint.TokenURL,
+			DeviceAuthURL: googleDeviceAuthURL,
+			ClientID:      opts.Config.DeviceClientID,
+			ClientSecret:  opts.Config.DeviceClientSecret,
+			Scopes:        []string{"openid", "email"},
+		},
 	}
 }
 
-// GetOAuthLoginURL returns the OAuth login URL
-func (c *Client) GetOAuthLoginURL() string {
-	return c.loginURL
+// NewLoginState generates the state, nonce and PKCE verifier for a login,
+// using the configured state generator if there is one
+func (c *Client) NewLoginState() (*oauth.LoginState, error) {
+	return oauth.NewLoginState(c.stateGenerator)
+}
+
+// GetOAuthLoginURL returns the OAuth login URL for the login
+func (c *Client) GetOAuthLoginURL(state *oauth.LoginState) string {
+	return generateOAuthLoginURL(c.oauthCfg, state)
 }
 
-// Exchange exchanges a code for a wrapped ID token
-func (c *Client) Exchange(ctx context.Context, code string) (*oauth.IDToken, error) {
-	tok, err := c.cfg.Exchange(context.Background(), code)
+// Provider returns what clients need to log into Google on their own
+func (c *Client) Provider() *oauth.Provider {
+	return c.provider
+}
+
+// Exchange exchanges a code for a wrapped ID token, checking the token was
+// issued for the login
+func (c *Client) Exchange(ctx context.Context, code string, state *oauth.LoginState) (*oauth.IDToken, error) {
+	tok, err := c.cfg.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", state.CodeVerifier))
 	if err != nil {
 		c.logger.Error("error exchanging OAuth code", zap.Error(err))
 		return nil, err
 	}
 
-	// Get the ID token from the token, which when the 2nd portion is base64 decoded
-	// gives us back something resembling:
-	idTokenStr := tok.Extra("id_token").(string)
+	idToken, err := c.verifyToken(ctx, tok)
+	if err != nil {
+		c.logger.Error("error verifying id token", zap.Error(err))
+		return nil, err
+	}
+
+	if err := state.CheckNonce(idToken); err != nil {
+		c.logger.Error("id token nonce does not match", zap.String("email", idToken.Email))
+		return nil, err
+	}
 
-	idToken, err := oauth.ParseIDToken(idTokenStr)
+	return idToken, nil
+}
+
+// VerifyIDToken verifies an ID token the client minted itself
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken string) (*oauth.IDToken, error) {
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		c.logger.Error("error parsing id token", zap.Error(err))
+		c.logger.Error("error verifying id token", zap.Error(err))
 		return nil, err
 	}
 
@@ -77,83 +131,83 @@ func (c *Client) TokenSourceFromCredentials(ctx context.Context, credentials []b
 	return creds.TokenSource, nil
 }
 
-// IDToken takes in a token source, validates it, and returns an ID token
-// TODO: For now, we're not using the production version - we're just hitting an endpoint to
-// validate that the token is valid. To productionize this we should be hitting the JWKS URI
+// IDToken takes in a token source, verifies the ID token against Google's
+// published signing keys, and returns it
 func (c *Client) IDToken(tokenSource oauth2.TokenSource) (*oauth.IDToken, error) {
-	v := url.Values{}
 	token, err := tokenSource.Token()
 	if err != nil {
 		c.logger.Error("error getting token from source", zap.Error(err))
 		return nil, err
 	}
 
-	idToken := token.Extra("id_token").(string)
-
-	v.Set("id_token", idToken)
-
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "www.googleapis.com",
-		Path:     "oauth2/v3/tokeninfo",
-		RawQuery: v.Encode(),
-	}
-
-	resp, err := http.Get(url.String())
+	idToken, err := c.verifyToken(context.Background(), token)
 	if err != nil {
-		c.logger.Error("error validating token", zap.Error(err))
+		c.logger.Error("error verifying id token", zap.Error(err))
 		return nil, err
 	}
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("invalid request validating token")
+	return idToken, nil
+}
+
+func (c *Client) verifyToken(ctx context.Context, token *oauth2.Token) (*oauth.IDToken, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrIDTokenNotFound
 	}
 
-	return oauth.ParseIDToken(idToken)
+	return c.verifier.Verify(ctx, rawIDToken)
 }
 
+// oauthConf builds the OAuth config, using Google's endpoints for any that
+// aren't configured
 func oauthConf(cfg config.OAuth) *oauth2.Config {
+	endpoint := oauth2.Endpoint{
+		TokenURL: cfg.TokenURL,
+		AuthURL:  cfg.AuthURL,
+	}
+	if endpoint.AuthURL == "" {
+		endpoint.AuthURL = googleAuthURL
+	}
+	if endpoint.TokenURL == "" {
+		endpoint.TokenURL = google.Endpoint.TokenURL
+	}
+
 	return &oauth2.Config{
 		ClientID:     cfg.ClientID,
 		ClientSecret: cfg.ClientSecret,
 		Scopes:       cfg.Scopes,
-		Endpoint: oauth2.Endpoint{
-			TokenURL: cfg.TokenURL,
-			AuthURL:  cfg.AuthURL,
-		},
-		RedirectURL: cfg.RedirectURL,
+		Endpoint:     endpoint,
+		RedirectURL:  cfg.RedirectURL,
 	}
 }
 
 /*
-	Formatting of the OAuth URL:
-	https://accounts.google.com/o/oauth2/v2/auth?
-	scope=https%3A%2F%2Fwww.googleapis.com%2Fauth%2Fdrive.metadata.readonly&
-	access_type=offline&
-	include_granted_scopes=true&
-	state=state_parameter_passthrough_value&
-	redirect_uri=http%3A%2F%2Foauth2.example.com%2Fcallback&
-	response_type=code&
-	client_id=client_id
+Formatting of the OAuth URL:
+https://accounts.google.com/o/oauth2/v2/auth?
+scope=https%3A%2F%2Fwww.googleapis.com%2Fauth%2Fdrive.metadata.readonly&
+access_type=offline&
+include_granted_scopes=true&
+state=state_parameter_passthrough_value&
+nonce=nonce_value&
+code_challenge=code_challenge_value&
+code_challenge_method=S256&
+redirect_uri=http%3A%2F%2Foauth2.example.com%2Fcallback&
+response_type=code&
+client_id=client_id
 */
-func generateOAuthLoginURL(cfg config.OAuth) string {
+func generateOAuthLoginURL(cfg config.OAuth, state *oauth.LoginState) string {
 	v := url.Values{}
-	v.Set("scope", "email")
+	v.Set("scope", "openid email")
 	// Setting access type to offline allows us to get an access and refresh token
 	v.Set("access_type", "offline")
 	v.Set("include_granted_scopes", "true")
-	// TODO: Need to generate a nonce for the state passthrough value
-	// v.Set("state", "state_parameter_passthrough_value")
+	v.Set("state", state.State)
+	v.Set("nonce", state.Nonce)
+	v.Set("code_challenge", state.CodeChallenge())
+	v.Set("code_challenge_method", oauth.PKCEMethod)
 	v.Set("redirect_uri", cfg.RedirectURL)
 	v.Set("client_id", cfg.ClientID)
 	v.Set("response_type", "code")
 
-	// TODO: This should be extracted out
-	url := url.URL{
-		Scheme:   "https",
-		Host:     "accounts.google.com",
-		Path:     "o/oauth2/v2/auth",
-		RawQuery: v.Encode(),
-	}
-	return url.String()
+	return oauthConf(cfg).Endpoint.AuthURL + "?" + v.Encode()
 }
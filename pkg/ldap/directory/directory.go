@@ -0,0 +1,375 @@
+package directory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+	ldap "gopkg.in/ldap.v3"
+)
+
+var (
+	ErrURLNotSet         = errors.New("LDAP URL must be set")
+	ErrUnsupportedScheme = errors.New("LDAP URL must start with ldap:// or ldaps://")
+	ErrStartTLSWithLDAPS = errors.New("StartTLS can't be used with ldaps://")
+	ErrBaseDNNotSet      = errors.New("LDAP base DN must be set")
+	ErrNoRoleSource      = errors.New("a role attribute or group roles must be set")
+	ErrUserNotFound      = directory.ErrUserNotFound
+	ErrMultipleUsers     = errors.New("more than one LDAP user matches the email")
+	ErrRoleNotSet        = errors.New("no roles found for the user")
+	ErrInvalidCAFile     = errors.New("no certificates found in CA file")
+)
+
+// Client is a directory.Service backed by an LDAP server, such as OpenLDAP.
+// Users are found by email, and their roles come from an attribute on the
+// user, the groups they're in, or both.
+type Client struct {
+	logger *zap.Logger
+	pool   *pool
+
+	baseDN         string
+	userFilter     string
+	roleAttribute  string
+	groupAttribute string
+	groupBaseDN    string
+	groupFilter    string
+	// Keyed by normalized group DN
+	groupRoles map[string]directory.Role
+	attributes map[string]string
+	timeout    time.Duration
+}
+
+// NewClient creates a Client. Nothing is dialed until the first lookup.
+func NewClient(setOpts ...Option) (*Client, error) {
+	opts := defaultOptions()
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	if opts.BaseDN == "" {
+		return nil, ErrBaseDNNotSet
+	}
+
+	if opts.RoleAttribute == "" && len(opts.GroupRoles) == 0 {
+		return nil, ErrNoRoleSource
+	}
+
+	groupRoles := map[string]directory.Role{}
+	for dn, value := range opts.GroupRoles {
+		role, err := directory.ParseRole(value)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %s", dn, err)
+		}
+		groupRoles[normalizeDN(dn)] = role
+	}
+
+	dial, err := dialer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		logger:         opts.Logger,
+		pool:           newPool(opts.PoolSize, dial),
+		baseDN:         opts.BaseDN,
+		userFilter:     opts.UserFilter,
+		roleAttribute:  opts.RoleAttribute,
+		groupAttribute: opts.GroupAttribute,
+		groupBaseDN:    opts.GroupBaseDN,
+		groupFilter:    opts.GroupFilter,
+		groupRoles:     groupRoles,
+		attributes:     opts.Attributes,
+		timeout:        opts.Timeout,
+	}, nil
+}
+
+// GetUser finds a user by email
+func (c *Client) GetUser(email string) (*directory.User, error) {
+	entry, err := c.findUser(email)
+	if err != nil {
+		c.logger.Error("error finding user", zap.String("email", email), zap.Error(err))
+		return nil, err
+	}
+
+	groups, err := c.userGroups(entry)
+	if err != nil {
+		c.logger.Error("error finding user's groups", zap.String("dn", entry.DN), zap.Error(err))
+		return nil, err
+	}
+
+	roles := c.getRoles(entry, groups)
+	if len(roles) == 0 {
+		c.logger.Error("error no valid roles found for user", zap.String("email", email))
+		return nil, ErrRoleNotSet
+	}
+
+	user := &directory.User{
+		Email:      email,
+		Roles:      roles,
+		Groups:     groups,
+		Attributes: map[string]string{},
+	}
+	if mail := entry.GetAttributeValue("mail"); mail != "" {
+		user.Email = mail
+	}
+	for key, attribute := range c.attributes {
+		if value := entry.GetAttributeValue(attribute); value != "" {
+			user.Attributes[key] = value
+		}
+	}
+
+	return user, nil
+}
+
+// Close closes the idle connections
+func (c *Client) Close() {
+	c.pool.close()
+}
+
+func (c *Client) findUser(email string) (*ldap.Entry, error) {
+	attributes := []string{"mail"}
+	if c.roleAttribute != "" {
+		attributes = append(attributes, c.roleAttribute)
+	}
+	if c.groupBaseDN == "" {
+		attributes = append(attributes, c.groupAttribute)
+	}
+	for _, attribute := range c.attributes {
+		attributes = append(attributes, attribute)
+	}
+
+	result, err := c.search(ldap.NewSearchRequest(
+		c.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		// Asking for two is enough to tell whether the email's ambiguous
+		2, int(c.timeout/time.Second), false,
+		fmt.Sprintf(c.userFilter, ldap.EscapeFilter(email)),
+		attributes,
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrMultipleUsers
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, ErrMultipleUsers
+	}
+}
+
+// userGroups returns the DNs of the groups the user's in
+func (c *Client) userGroups(entry *ldap.Entry) ([]string, error) {
+	if len(c.groupRoles) == 0 {
+		return nil, nil
+	}
+
+	if c.groupBaseDN == "" {
+		return entry.GetAttributeValues(c.groupAttribute), nil
+	}
+
+	result, err := c.search(ldap.NewSearchRequest(
+		c.groupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(c.timeout/time.Second), false,
+		fmt.Sprintf(c.groupFilter, ldap.EscapeFilter(entry.DN)),
+		// Only the DNs are needed
+		[]string{"1.1"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []string{}
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+func (c *Client) getRoles(entry *ldap.Entry, groups []string) []directory.Role {
+	roles := []directory.Role{}
+	seen := map[string]bool{}
+	add := func(role directory.Role) {
+		if !seen[role.ARN] {
+			seen[role.ARN] = true
+			roles = append(roles, role)
+		}
+	}
+
+	if c.roleAttribute != "" {
+		for _, value := range entry.GetAttributeValues(c.roleAttribute) {
+			role, err := directory.ParseRole(value)
+			if err != nil {
+				c.logger.Warn("skipping invalid role", zap.String("dn", entry.DN), zap.String("value", value))
+				continue
+			}
+			add(role)
+		}
+	}
+
+	for _, group := range groups {
+		if role, ok := c.groupRoles[normalizeDN(group)]; ok {
+			add(role)
+		}
+	}
+
+	return roles
+}
+
+// search runs the search on a pooled connection. If the connection turns
+// out to have gone stale, it's thrown away and the search tried once more on
+// a fresh one.
+func (c *Client) search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := c.pool.get()
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := conn.Search(req)
+		if err != nil && isConnError(err) {
+			conn.Close()
+			if attempt == 0 {
+				continue
+			}
+			return nil, err
+		}
+
+		c.pool.put(conn)
+		return result, err
+	}
+}
+
+// isConnError checks whether the error came from the connection rather than
+// the server answering the request. Errors from a connection that's been
+// closed under us don't always come back as LDAP errors.
+func isConnError(err error) bool {
+	ldapErr, ok := err.(*ldap.Error)
+	return !ok || ldapErr.ResultCode == ldap.ErrorNetwork
+}
+
+// dialer returns a function that connects and binds to the server
+func dialer(opts *Options) (func() (*ldap.Conn, error), error) {
+	if opts.URL == "" {
+		return nil, ErrURLNotSet
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Hostname()
+	port := u.Port()
+
+	tlsConfig := &tls.Config{}
+	if opts.TLSConfig != nil {
+		tlsConfig = opts.TLSConfig.Clone()
+	}
+	// StartTLS doesn't fill this in for us
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+
+	var ldaps bool
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if opts.StartTLS {
+			return nil, ErrStartTLSWithLDAPS
+		}
+		ldaps = true
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, ErrUnsupportedScheme
+	}
+
+	addr := net.JoinHostPort(host, port)
+
+	return func() (*ldap.Conn, error) {
+		var conn *ldap.Conn
+		var err error
+		if ldaps {
+			conn, err = ldap.DialTLS("tcp", addr, tlsConfig)
+		} else {
+			conn, err = ldap.Dial("tcp", addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conn.SetTimeout(opts.Timeout)
+
+		if opts.StartTLS {
+			if err := conn.StartTLS(tlsConfig); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		// Without a bind DN, searches run anonymously
+		if opts.BindDN != "" {
+			if err := conn.Bind(opts.BindDN, opts.BindPassword); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		return conn, nil
+	}, nil
+}
+
+// TLSConfig builds the TLS config for connecting to the server, trusting the
+// CA file on top of the system's roots if one is given
+func TLSConfig(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile == "" {
+		return config, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrInvalidCAFile
+	}
+	config.RootCAs = pool
+
+	return config, nil
+}
+
+// normalizeDN makes DNs comparable regardless of case or spacing around
+// their separators
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,381 @@
+package directory
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+	ber "gopkg.in/asn1-ber.v1"
+	ldap "gopkg.in/ldap.v3"
+)
+
+const (
+	adminARN    = "arn:aws:iam::111111111111:role/admin"
+	readonlyARN = "arn:aws:iam::111111111111:role/readonly"
+	providerARN = "arn:aws:iam::111111111111:saml-provider/LDAP"
+	aliceDN     = "uid=alice,ou=people,dc=example,dc=com"
+	opsDN       = "cn=ops,ou=groups,dc=example,dc=com"
+)
+
+type fakeEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// fakeLDAP is an in-process LDAP server that answers binds for one account
+// and searches with canned entries for each filter
+type fakeLDAP struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	bindDN       string
+	bindPassword string
+	results      map[string][]fakeEntry
+
+	mu    sync.Mutex
+	conns []net.Conn
+	binds int
+}
+
+func newFakeLDAP(t *testing.T, listener net.Listener, tlsConfig *tls.Config) *fakeLDAP {
+	f := &fakeLDAP{
+		listener:     listener,
+		tlsConfig:    tlsConfig,
+		bindDN:       "cn=sso,dc=example,dc=com",
+		bindPassword: "secret",
+		results: map[string][]fakeEntry{
+			"(mail=alice@example.com)": {{
+				dn: aliceDN,
+				attributes: map[string][]string{
+					"mail":           {"alice@example.com"},
+					"awsRole":        {readonlyARN + "," + providerARN, "not a role"},
+					"memberOf":       {"CN=ops, OU=groups, DC=example, DC=com", "cn=other,ou=groups,dc=example,dc=com"},
+					"departmentName": {"Engineering"},
+				},
+			}},
+			"(mail=twins@example.com)": {
+				{dn: "uid=twin1,ou=people,dc=example,dc=com"},
+				{dn: "uid=twin2,ou=people,dc=example,dc=com"},
+			},
+			"(member=" + aliceDN + ")": {{dn: opsDN}},
+		},
+	}
+
+	go f.serve()
+	return f
+}
+
+func (f *fakeLDAP) url(scheme string) string {
+	return scheme + "://" + f.listener.Addr().String()
+}
+
+func (f *fakeLDAP) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+
+		go f.handle(conn)
+	}
+}
+
+// dropConnections closes every connection, like a server restarting
+func (f *fakeLDAP) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeLDAP) bindCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.binds
+}
+
+func (f *fakeLDAP) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			f.mu.Lock()
+			f.binds++
+			f.mu.Unlock()
+
+			code := int64(ldap.LDAPResultSuccess)
+			if op.Children[1].Value.(string) != f.bindDN || op.Children[2].Data.String() != f.bindPassword {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			sizeLimit := int(op.Children[3].Value.(int64))
+
+			entries := f.results[filter]
+			code := int64(ldap.LDAPResultSuccess)
+			if sizeLimit > 0 && len(entries) >= sizeLimit {
+				entries = entries[:sizeLimit]
+				code = ldap.LDAPResultSizeLimitExceeded
+			}
+
+			for _, entry := range entries {
+				conn.Write(searchEntry(messageID, entry).Bytes())
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationSearchResultDone, code).Bytes())
+		case ldap.ApplicationExtendedRequest:
+			conn.Write(ldapResult(messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess).Bytes())
+			conn = tls.Server(conn, f.tlsConfig)
+		default:
+			return
+		}
+	}
+}
+
+func ldapResult(messageID int64, tag ber.Tag, code int64) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	packet.AppendChild(result)
+
+	return packet
+}
+
+func searchEntry(messageID int64, entry fakeEntry) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+	packet.AppendChild(result)
+
+	return packet
+}
+
+// testTLS borrows httptest's certificate, which is good for 127.0.0.1
+func testTLS() (server *tls.Config, client *tls.Config) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	server = &tls.Config{Certificates: srv.TLS.Certificates}
+	client = &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	return server, client
+}
+
+func listen(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s\n", err.Error())
+	}
+	return listener
+}
+
+func TestGetUser(t *testing.T) {
+	f := newFakeLDAP(t, listen(t), nil)
+	defer f.listener.Close()
+
+	groupRoles := map[string]string{opsDN: adminARN + "," + providerARN}
+	admin := directory.Role{ARN: adminARN, ProviderARN: providerARN}
+	readonly := directory.Role{ARN: readonlyARN, ProviderARN: providerARN}
+
+	testCases := []struct {
+		opts          []Option
+		email         string
+		expectedRoles []directory.Role
+		expectedErr   error
+	}{
+		// Roles from the user's attribute, then their memberOf groups
+		{
+			opts:          []Option{WithRoleAttribute("awsRole"), WithGroupRoles(groupRoles)},
+			email:         "alice@example.com",
+			expectedRoles: []directory.Role{readonly, admin},
+		},
+		// Groups searched for instead
+		{
+			opts:          []Option{WithGroupRoles(groupRoles), WithGroupSearch("ou=groups,dc=example,dc=com", "")},
+			email:         "alice@example.com",
+			expectedRoles: []directory.Role{admin},
+		},
+		{
+			opts:        []Option{WithRoleAttribute("awsRole")},
+			email:       "nobody@example.com",
+			expectedErr: ErrUserNotFound,
+		},
+		{
+			opts:        []Option{WithRoleAttribute("awsRole")},
+			email:       "twins@example.com",
+			expectedErr: ErrMultipleUsers,
+		},
+		// In the directory, but without any roles
+		{
+			opts:        []Option{WithGroupRoles(map[string]string{"cn=other,dc=example,dc=com": adminARN + "," + providerARN})},
+			email:       "alice@example.com",
+			expectedErr: ErrRoleNotSet,
+		},
+	}
+
+	for i, testCase := range testCases {
+		opts := append([]Option{
+			WithLogger(zap.NewNop()),
+			WithURL(f.url("ldap")),
+			WithBind("cn=sso,dc=example,dc=com", "secret"),
+			WithBaseDN("ou=people,dc=example,dc=com"),
+			WithAttributes(map[string]string{directory.AttributeDepartment: "departmentName"}),
+		}, testCase.opts...)
+
+		c, err := NewClient(opts...)
+		if err != nil {
+			t.Fatalf("[%d] - Expected no error creating client, got %v", i, err)
+		}
+
+		user, err := c.GetUser(testCase.email)
+		c.Close()
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if !reflect.DeepEqual(user.Roles, testCase.expectedRoles) {
+			t.Errorf("[%d] - Expected roles %+v, got %+v", i, testCase.expectedRoles, user.Roles)
+		}
+		if user.Email != "alice@example.com" || user.Attributes[directory.AttributeDepartment] != "Engineering" {
+			t.Errorf("[%d] - Expected alice in Engineering, got %+v", i, user)
+		}
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	f := newFakeLDAP(t, listen(t), nil)
+	defer f.listener.Close()
+
+	c, err := NewClient(
+		WithLogger(zap.NewNop()),
+		WithURL(f.url("ldap")),
+		WithBind("cn=sso,dc=example,dc=com", "secret"),
+		WithBaseDN("ou=people,dc=example,dc=com"),
+		WithRoleAttribute("awsRole"),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetUser("alice@example.com"); err != nil {
+			t.Fatalf("[%d] - Expected no error, got %v", i, err)
+		}
+	}
+	if binds := f.bindCount(); binds != 1 {
+		t.Errorf("Expected the connection to be reused, got %d binds", binds)
+	}
+
+	// Lookups carry on over a new connection once the old one's gone
+	f.dropConnections()
+	if _, err := c.GetUser("alice@example.com"); err != nil {
+		t.Errorf("Expected no error after reconnecting, got %v", err)
+	}
+	if binds := f.bindCount(); binds != 2 {
+		t.Errorf("Expected one more bind, got %d binds", binds)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	serverTLS, clientTLS := testTLS()
+
+	plain := newFakeLDAP(t, listen(t), serverTLS)
+	defer plain.listener.Close()
+
+	ldaps := newFakeLDAP(t, tls.NewListener(listen(t), serverTLS), nil)
+	defer ldaps.listener.Close()
+
+	testCases := []struct {
+		opts      []Option
+		expectErr bool
+	}{
+		{opts: []Option{WithURL(plain.url("ldap")), WithStartTLS(true), WithTLSConfig(clientTLS)}},
+		{opts: []Option{WithURL(ldaps.url("ldaps")), WithTLSConfig(clientTLS)}},
+		// Without trusting the server's certificate
+		{opts: []Option{WithURL(plain.url("ldap")), WithStartTLS(true)}, expectErr: true},
+		{opts: []Option{WithURL(ldaps.url("ldaps"))}, expectErr: true},
+		// Wrong password
+		{opts: []Option{WithURL(ldaps.url("ldaps")), WithTLSConfig(clientTLS), WithBind("cn=sso,dc=example,dc=com", "wrong")}, expectErr: true},
+	}
+
+	for i, testCase := range testCases {
+		opts := append([]Option{
+			WithLogger(zap.NewNop()),
+			WithBind("cn=sso,dc=example,dc=com", "secret"),
+			WithBaseDN("ou=people,dc=example,dc=com"),
+			WithRoleAttribute("awsRole"),
+		}, testCase.opts...)
+
+		c, err := NewClient(opts...)
+		if err != nil {
+			t.Fatalf("[%d] - Expected no error creating client, got %v", i, err)
+		}
+
+		_, err = c.GetUser("alice@example.com")
+		c.Close()
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("[%d] - Expected error: %t, got %v", i, testCase.expectErr, err)
+		}
+	}
+}
+
+func TestNewClientValidation(t *testing.T) {
+	testCases := []struct {
+		opts        []Option
+		expectedErr error
+	}{
+		{opts: []Option{WithBaseDN("dc=example"), WithRoleAttribute("awsRole")}, expectedErr: ErrURLNotSet},
+		{opts: []Option{WithURL("ldap://localhost"), WithRoleAttribute("awsRole")}, expectedErr: ErrBaseDNNotSet},
+		{opts: []Option{WithURL("ldap://localhost"), WithBaseDN("dc=example")}, expectedErr: ErrNoRoleSource},
+		{opts: []Option{WithURL("http://localhost"), WithBaseDN("dc=example"), WithRoleAttribute("awsRole")}, expectedErr: ErrUnsupportedScheme},
+		{opts: []Option{WithURL("ldaps://localhost"), WithBaseDN("dc=example"), WithRoleAttribute("awsRole"), WithStartTLS(true)}, expectedErr: ErrStartTLSWithLDAPS},
+	}
+
+	for i, testCase := range testCases {
+		if _, err := NewClient(testCase.opts...); err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package directory
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Options contains all Client options
+type Options struct {
+	Logger *zap.Logger
+	// ldap://host[:port] or ldaps://host[:port]
+	URL string
+	// Upgrade ldap:// connections with StartTLS
+	StartTLS  bool
+	TLSConfig *tls.Config
+	// The service account searches are made as
+	BindDN       string
+	BindPassword string
+	// Where users are searched for
+	BaseDN string
+	// Finds the user, with %s replaced by their escaped email
+	UserFilter string
+	// Attribute on the user holding roles as <role arn>,<provider arn>
+	RoleAttribute string
+	// Attribute on the user listing the DNs of their groups
+	GroupAttribute string
+	// When set, groups are searched for here instead of being read off the
+	// user, for servers without memberOf
+	GroupBaseDN string
+	// Finds the user's groups, with %s replaced by the user's escaped DN
+	GroupFilter string
+	// Roles granted to members of each group, keyed by group DN
+	GroupRoles map[string]string
+	// Directory attributes to copy onto the user, keyed by our name for them
+	Attributes map[string]string
+	// How many bound connections to keep around
+	PoolSize int
+	Timeout  time.Duration
+}
+
+// Option is a functional way of setting options for the Client
+type Option func(o *Options)
+
+// WithLogger sets the logger on the Options struct
+func WithLogger(l *zap.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithURL sets the server to connect to
+func WithURL(url string) Option {
+	return func(o *Options) {
+		o.URL = url
+	}
+}
+
+// WithStartTLS turns on StartTLS for ldap:// connections
+func WithStartTLS(startTLS bool) Option {
+	return func(o *Options) {
+		o.StartTLS = startTLS
+	}
+}
+
+// WithTLSConfig sets the TLS config for ldaps:// and StartTLS connections
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = c
+	}
+}
+
+// WithBind sets the service account to bind as
+func WithBind(dn, password string) Option {
+	return func(o *Options) {
+		o.BindDN = dn
+		o.BindPassword = password
+	}
+}
+
+// WithBaseDN sets where users are searched for
+func WithBaseDN(dn string) Option {
+	return func(o *Options) {
+		o.BaseDN = dn
+	}
+}
+
+// WithUserFilter sets the filter users are found with
+func WithUserFilter(filter string) Option {
+	return func(o *Options) {
+		o.UserFilter = filter
+	}
+}
+
+// WithRoleAttribute sets the user attribute roles are read from
+func WithRoleAttribute(attribute string) Option {
+	return func(o *Options) {
+		o.RoleAttribute = attribute
+	}
+}
+
+// WithGroupAttribute sets the user attribute groups are read from
+func WithGroupAttribute(attribute string) Option {
+	return func(o *Options) {
+		o.GroupAttribute = attribute
+	}
+}
+
+// WithGroupSearch searches for the user's groups instead of reading them
+// off the user
+func WithGroupSearch(baseDN, filter string) Option {
+	return func(o *Options) {
+		o.GroupBaseDN = baseDN
+		if filter != "" {
+			o.GroupFilter = filter
+		}
+	}
+}
+
+// WithGroupRoles sets the roles granted to members of each group
+func WithGroupRoles(groupRoles map[string]string) Option {
+	return func(o *Options) {
+		o.GroupRoles = groupRoles
+	}
+}
+
+// WithAttributes sets the directory attributes copied onto users
+func WithAttributes(attributes map[string]string) Option {
+	return func(o *Options) {
+		o.Attributes = attributes
+	}
+}
+
+// WithPoolSize sets how many bound connections are kept around
+func WithPoolSize(size int) Option {
+	return func(o *Options) {
+		o.PoolSize = size
+	}
+}
+
+// WithTimeout sets the timeout for each request
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Logger:         logging.Logger(),
+		UserFilter:     "(mail=%s)",
+		GroupAttribute: "memberOf",
+		GroupFilter:    "(member=%s)",
+		PoolSize:       4,
+		Timeout:        10 * time.Second,
+	}
+}
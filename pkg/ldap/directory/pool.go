@@ -0,0 +1,59 @@
+package directory
+
+import (
+	ldap "gopkg.in/ldap.v3"
+)
+
+// pool keeps bound connections around between lookups. Connections are only
+// ever bound as the service account, so any of them will do.
+type pool struct {
+	dial  func() (*ldap.Conn, error)
+	conns chan *ldap.Conn
+}
+
+func newPool(size int, dial func() (*ldap.Conn, error)) *pool {
+	return &pool{
+		dial:  dial,
+		conns: make(chan *ldap.Conn, size),
+	}
+}
+
+// get returns an idle connection, or dials a new one if there aren't any
+func (p *pool) get() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-p.conns:
+			if conn.IsClosing() {
+				continue
+			}
+			return conn, nil
+		default:
+			return p.dial()
+		}
+	}
+}
+
+// put hands a connection back, closing it if the pool's full
+func (p *pool) put(conn *ldap.Conn) {
+	if conn.IsClosing() {
+		return
+	}
+
+	select {
+	case p.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// close closes all idle connections
+func (p *pool) close() {
+	for {
+		select {
+		case conn := <-p.conns:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
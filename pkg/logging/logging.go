@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"os"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,14 +16,14 @@ var (
 // Configure configures the zap logger for Stackdriver
 func Configure(env string) (err error) {
 	if env == "" {
-		fmt.Println("using development logger")
+		fmt.Fprintln(os.Stderr, "using development logger")
 		config := zap.NewDevelopmentConfig()
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 		logger, err = config.Build()
 		return
 	}
 
-	fmt.Println("using production logger")
+	fmt.Fprintln(os.Stderr, "using production logger")
 	logger, err = zap.NewProduction()
 	return
 }
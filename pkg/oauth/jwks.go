@@ -0,0 +1,257 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Used when the JWKS response doesn't tell us how long it can be cached
+	defaultKeySetTTL = time.Hour
+	// Unknown key IDs trigger a refresh, but never more often than this so a
+	// flood of garbage tokens can't turn into a flood of JWKS requests
+	minKeySetRefreshInterval = time.Minute
+	// After a failed fetch the provider is tried again sooner, so a blip
+	// doesn't lock out newly rotated keys for long
+	minKeySetRetryInterval = 5 * time.Second
+	// How long a fetch gets, whoever is waiting on it
+	keySetFetchTimeout = 10 * time.Second
+)
+
+var (
+	ErrKeyNotFound = errors.New("signing key not found in key set")
+)
+
+// KeySource looks up the public key used to sign a token
+type KeySource interface {
+	Key(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// KeySet is a KeySource backed by a remote JWKS document. Keys are cached
+// according to the Cache-Control header of the response, and the set is
+// refetched when a token shows up signed with a key we haven't seen yet,
+// which is how providers like Google roll their keys.
+type KeySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.RWMutex
+	keys   map[string]*rsa.PublicKey
+	expiry time.Time
+	// When the set was last fetched, or tried to be, and how that went
+	lastRefresh time.Time
+	refreshErr  error
+	// The fetch in flight. Nil if there isn't one.
+	refreshing *keySetRefresh
+}
+
+// keySetRefresh is a fetch of the key set that callers can wait on
+type keySetRefresh struct {
+	// Closed once the fetch is done, after err is set
+	done chan struct{}
+	err  error
+}
+
+// NewKeySet creates a KeySet that fetches keys from the JWKS URL
+func NewKeySet(url string, client *http.Client) *KeySet {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &KeySet{
+		url:    url,
+		client: client,
+		now:    time.Now,
+		keys:   map[string]*rsa.PublicKey{},
+	}
+}
+
+// Key returns the key matching the key ID, refreshing the set if needed
+func (k *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	fresh := k.now().Before(k.expiry)
+	k.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		// Keep serving the keys we already know about if the provider is
+		// having a bad day
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok = k.keys[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// refresh refetches the key set. Only one fetch is ever in flight, and
+// nobody waits on the lock while it's out. The fetch isn't tied to any one
+// caller, so a caller giving up doesn't fail it for everyone else waiting.
+// Attempts are rate limited whether they work or not, so neither a flood of
+// unknown key IDs nor a provider that's down turns into a flood of requests;
+// callers held off after a failure get that failure back.
+func (k *KeySet) refresh(ctx context.Context) error {
+	k.mu.Lock()
+	refreshing := k.refreshing
+	if refreshing == nil {
+		now := k.now()
+		interval := minKeySetRefreshInterval
+		if k.refreshErr != nil {
+			interval = minKeySetRetryInterval
+		}
+		if now.Sub(k.lastRefresh) < interval {
+			err := k.refreshErr
+			k.mu.Unlock()
+			return err
+		}
+		k.lastRefresh = now
+
+		refreshing = &keySetRefresh{done: make(chan struct{})}
+		k.refreshing = refreshing
+		go k.fetchInto(refreshing, now)
+	}
+	k.mu.Unlock()
+
+	select {
+	case <-refreshing.done:
+		return refreshing.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchInto fetches the key set for the refresh, swapping in the new keys if
+// it works
+func (k *KeySet) fetchInto(refreshing *keySetRefresh, started time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), keySetFetchTimeout)
+	defer cancel()
+
+	keys, ttl, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	if err == nil {
+		k.keys = keys
+		k.expiry = started.Add(ttl)
+	}
+	k.refreshErr = err
+	k.refreshing = nil
+	k.mu.Unlock()
+
+	refreshing.err = err
+	close(refreshing.done)
+}
+
+// fetch gets the key set and how long it can be cached for
+func (k *KeySet) fetch(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := k.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("error fetching key set: %s", resp.Status)
+	}
+
+	keys, err := parseJWKS(body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return keys, cacheTTL(resp.Header.Get("Cache-Control")), nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func parseJWKS(body []byte) (map[string]*rsa.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		// We only verify RS256, so anything else in the set is skipped
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func cacheTTL(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err != nil || seconds <= 0 {
+			break
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	return defaultKeySetTTL
+}
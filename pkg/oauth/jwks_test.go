@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeySetFailedRefresh(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1500000000, 0)
+	keySet := NewKeySet(srv.URL, srv.Client())
+	keySet.now = func() time.Time { return now }
+
+	testCases := []struct {
+		advance      time.Duration
+		expectedHits int
+	}{
+		{expectedHits: 1},
+		// A failed fetch holds off the next one, and the failure is what's
+		// reported rather than the key not being found
+		{advance: 3 * time.Second, expectedHits: 1},
+		// but not for as long as a good one would
+		{advance: 3 * time.Second, expectedHits: 2},
+	}
+
+	for i, testCase := range testCases {
+		now = now.Add(testCase.advance)
+		_, err := keySet.Key(context.Background(), "key-1")
+		if err == nil || err == ErrKeyNotFound {
+			t.Errorf("[%d] - Expected the fetch error, got %v\n", i, err)
+		}
+		if hits != testCase.expectedHits {
+			t.Errorf("[%d] - Expected %d fetches, got %d\n", i, testCase.expectedHits, hits)
+		}
+	}
+}
+
+func TestKeySetRefreshOutlivesCaller(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %s\n", err.Error())
+	}
+
+	hits := 0
+	handler := jwksHandler(map[string]*rsa.PrivateKey{"key-1": key}, &hits)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		handler(w, req)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1500000000, 0)
+	keySet := NewKeySet(srv.URL, srv.Client())
+	keySet.now = func() time.Time { return now }
+
+	// The caller that set off the fetch gives up on it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := keySet.Key(ctx, "key-1")
+		cancelled <- err
+	}()
+
+	<-started
+	cancel()
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("Expected %v, got %v\n", context.Canceled, err)
+	}
+
+	// The fetch carries on for anyone else, who gets the key once it's done
+	close(release)
+	if _, err := keySet.Key(context.Background(), "key-1"); err != nil {
+		t.Errorf("Expected the key, got %v\n", err)
+	}
+	if hits != 1 {
+		t.Errorf("Expected the key set to be fetched once, got %d\n", hits)
+	}
+}
@@ -0,0 +1,51 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+const (
+	// PKCEMethod is the only code challenge method we use
+	PKCEMethod = "S256"
+	// Bytes of randomness in generated values. 32 bytes comes out to a 43
+	// character verifier, the minimum PKCE allows.
+	randomBytes = 32
+)
+
+// RandomString returns a URL safe string with enough randomness to be used
+// as a state, nonce or PKCE verifier
+func RandomString() (string, error) {
+	b := make([]byte, randomBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCE holds a code verifier and the challenge derived from it
+// https://tools.ietf.org/html/rfc7636
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE generates a new code verifier and its S256 challenge
+func NewPKCE() (*PKCE, error) {
+	verifier, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKCE{
+		Verifier:  verifier,
+		Challenge: PKCEChallenge(verifier),
+	}, nil
+}
+
+// PKCEChallenge derives the S256 challenge for a verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
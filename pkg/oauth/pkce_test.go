@@ -0,0 +1,34 @@
+package oauth
+
+import "testing"
+
+func TestPKCEChallenge(t *testing.T) {
+	// Example from RFC 7636 Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	expected := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != expected {
+		t.Errorf("Expected challenge %s, got %s", expected, got)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	first, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(first.Verifier) < 43 {
+		t.Errorf("Expected a verifier of at least 43 characters, got %d", len(first.Verifier))
+	}
+	if first.Verifier == second.Verifier {
+		t.Errorf("Expected verifiers to be random")
+	}
+	if first.Challenge != PKCEChallenge(first.Verifier) {
+		t.Errorf("Expected challenge to be derived from the verifier")
+	}
+}
@@ -0,0 +1,17 @@
+package oauth
+
+// Provider describes how a client can log into the identity provider on its
+// own, e.g. with the device flow. Clients that run on users' machines can't
+// keep a secret, so nothing in here is one.
+type Provider struct {
+	AuthURL string
+	// Where codes are exchanged and tokens refreshed
+	TokenURL string
+	// Where device codes are requested. Empty if the provider doesn't
+	// support the device flow.
+	DeviceAuthURL string
+	// The public client users log in with
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
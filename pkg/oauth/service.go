@@ -8,8 +8,19 @@ import (
 
 // Service ...
 type Service interface {
-	GetOAuthLoginURL() string
-	Exchange(ctx context.Context, code string) (*IDToken, error)
+	// NewLoginState generates the state, nonce and PKCE verifier for a login
+	NewLoginState() (*LoginState, error)
+	// GetOAuthLoginURL returns where to send the user to log in
+	GetOAuthLoginURL(state *LoginState) string
+	// Provider returns what clients need to log in on their own
+	Provider() *Provider
+	// Exchange exchanges the callback's code, checking the ID token belongs
+	// to the login
+	Exchange(ctx context.Context, code string, state *LoginState) (*IDToken, error)
+	// VerifyIDToken verifies a raw ID token sent by a client
+	VerifyIDToken(ctx context.Context, rawIDToken string) (*IDToken, error)
+	// Deprecated: clients used to send their whole credentials file for the
+	// server to mint tokens with. Only kept around while clients migrate.
 	TokenSourceFromCredentials(ctx context.Context, credentials []byte) (oauth2.TokenSource, error)
 	IDToken(oauth2.TokenSource) (*IDToken, error)
 }
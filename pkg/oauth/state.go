@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+var (
+	ErrNonceMismatch = errors.New("id token nonce does not match the login")
+)
+
+// LoginState is what a login through the server has to remember between
+// sending the user off to the provider and the callback
+type LoginState struct {
+	// Ties the callback to the browser that started the login
+	State string
+	// Ties the ID token to the login
+	Nonce string
+	// PKCE verifier for the code exchange
+	CodeVerifier string
+}
+
+// NewLoginState generates the values for a new login. The state comes from
+// the generator if there is one, everything else is random.
+func NewLoginState(generator func() string) (*LoginState, error) {
+	state := ""
+	if generator != nil {
+		state = generator()
+	}
+	if state == "" {
+		var err error
+		if state, err = RandomString(); err != nil {
+			return nil, err
+		}
+	}
+
+	nonce, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	pkce, err := NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: pkce.Verifier,
+	}, nil
+}
+
+// CodeChallenge is the PKCE challenge sent with the login
+func (l *LoginState) CodeChallenge() string {
+	return PKCEChallenge(l.CodeVerifier)
+}
+
+// CheckNonce makes sure the ID token was issued for this login
+func (l *LoginState) CheckNonce(idToken *IDToken) error {
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(l.Nonce)) != 1 {
+		return ErrNonceMismatch
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package oauth
+
+import "testing"
+
+func TestNewLoginState(t *testing.T) {
+	state, err := NewLoginState(func() string { return "generated" })
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if state.State != "generated" {
+		t.Errorf("Expected state from the generator, got %s", state.State)
+	}
+	if state.Nonce == "" || state.CodeVerifier == "" || state.Nonce == state.CodeVerifier {
+		t.Errorf("Expected random nonce and verifier, got %q and %q", state.Nonce, state.CodeVerifier)
+	}
+	if state.CodeChallenge() != PKCEChallenge(state.CodeVerifier) {
+		t.Errorf("Expected challenge for the verifier, got %s", state.CodeChallenge())
+	}
+
+	// Without a generator, or one that comes up empty, the state is random
+	for i, generator := range []func() string{nil, func() string { return "" }} {
+		first, _ := NewLoginState(generator)
+		second, _ := NewLoginState(generator)
+		if first.State == "" || first.State == second.State {
+			t.Errorf("[%d] - Expected random states, got %q and %q", i, first.State, second.State)
+		}
+	}
+}
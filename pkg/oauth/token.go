@@ -3,6 +3,7 @@ package oauth
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"strings"
 )
 
@@ -10,10 +11,12 @@ import (
 type IDToken struct {
 	Iss      string `json:"iss"`
 	Aud      string `json:"aud"`
+	Azp      string `json:"azp"`
 	Sub      string `json:"sub"`
 	Hd       string `json:"hd"`
 	Email    string `json:"email"`
 	Verified bool   `json:"email_verified"`
+	Nonce    string `json:"nonce"`
 	Iat      int    `json:"iat"`
 	Exp      int    `json:"exp"`
 }
@@ -21,6 +24,9 @@ type IDToken struct {
 // ParseIDToken takes in an ID token as string
 func ParseIDToken(idToken string) (*IDToken, error) {
 	split := strings.Split(idToken, ".")
+	if len(split) != 3 {
+		return nil, ErrMalformedToken
+	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(split[1])
 	if err != nil {
@@ -33,3 +39,50 @@ func ParseIDToken(idToken string) (*IDToken, error) {
 	}
 	return token, nil
 }
+
+// UnmarshalJSON handles providers that send the aud claim as a list. Only the
+// first audience is kept - the Verifier is what checks the full list.
+func (t *IDToken) UnmarshalJSON(b []byte) error {
+	type alias IDToken
+	aux := struct {
+		*alias
+		Aud      audience `json:"aud"`
+		Verified jsonBool `json:"email_verified"`
+	}{alias: (*alias)(t)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	if len(aux.Aud) > 0 {
+		t.Aud = aux.Aud[0]
+	}
+	t.Verified = bool(aux.Verified)
+	return nil
+}
+
+// jsonBool is a bool that can also be sent as a string, like the
+// email_verified claim in some of Google's tokens
+type jsonBool bool
+
+func (v *jsonBool) UnmarshalJSON(b []byte) error {
+	var value bool
+	if err := json.Unmarshal(b, &value); err == nil {
+		*v = jsonBool(value)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	switch s {
+	case "true":
+		*v = true
+	case "false":
+		*v = false
+	default:
+		return fmt.Errorf("invalid bool %q", s)
+	}
+	return nil
+}
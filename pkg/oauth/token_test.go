@@ -32,6 +32,20 @@ func TestParseIDToken(t *testing.T) {
 				Verified: true,
 			},
 		},
+		// Some tokens send email_verified as a string
+		{
+			token:    "foo.eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiZW1haWxfdmVyaWZpZWQiOiJ0cnVlIn0.bar",
+			expected: &IDToken{Email: "foo@bar.com", Verified: true},
+		},
+		{
+			token:    "foo.eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiZW1haWxfdmVyaWZpZWQiOiJmYWxzZSJ9.bar",
+			expected: &IDToken{Email: "foo@bar.com"},
+		},
+		// Anything else is an error rather than a guess
+		{
+			token:     "foo.eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiZW1haWxfdmVyaWZpZWQiOiJ5ZXMifQ.bar",
+			expectErr: true,
+		},
 	}
 
 	for i, testCase := range testCases {
@@ -0,0 +1,216 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClockSkew = 2 * time.Minute
+)
+
+var (
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature     = errors.New("invalid token signature")
+	ErrInvalidIssuer        = errors.New("invalid token issuer")
+	ErrInvalidAudience      = errors.New("invalid token audience")
+	ErrTokenExpired         = errors.New("token is expired")
+	ErrTokenIssuedInFuture  = errors.New("token issued in the future")
+)
+
+// Verifier checks the signature and claims of an ID token locally, using
+// the provider's published signing keys.
+type Verifier struct {
+	keys      KeySource
+	issuers   []string
+	audiences []string
+	clockSkew time.Duration
+	now       func() time.Time
+}
+
+// VerifierOptions contains all Verifier options
+type VerifierOptions struct {
+	// Issuers accepted in the iss claim
+	Issuers []string
+	// Audiences accepted in the aud claim. At least one must be set.
+	Audiences []string
+	// How far the exp and iat claims may be off from our clock
+	ClockSkew time.Duration
+}
+
+// VerifierOption is a functional way of setting options for the Verifier
+type VerifierOption func(o *VerifierOptions)
+
+// WithIssuers sets the accepted issuers
+func WithIssuers(issuers ...string) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.Issuers = issuers
+	}
+}
+
+// WithAudiences sets the accepted audiences
+func WithAudiences(audiences ...string) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.Audiences = audiences
+	}
+}
+
+// WithClockSkew sets the allowed clock skew
+func WithClockSkew(d time.Duration) VerifierOption {
+	return func(o *VerifierOptions) {
+		o.ClockSkew = d
+	}
+}
+
+// NewVerifier creates a Verifier that checks tokens against the key source
+func NewVerifier(keys KeySource, setOpts ...VerifierOption) *Verifier {
+	opts := &VerifierOptions{
+		ClockSkew: defaultClockSkew,
+	}
+
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	return &Verifier{
+		keys:      keys,
+		issuers:   opts.Issuers,
+		audiences: opts.Audiences,
+		clockSkew: opts.ClockSkew,
+		now:       time.Now,
+	}
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// The aud claim can be either a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*a = audience(multiple)
+	return nil
+}
+
+type tokenClaims struct {
+	Iss string   `json:"iss"`
+	Aud audience `json:"aud"`
+	Iat int64    `json:"iat"`
+	Exp int64    `json:"exp"`
+}
+
+// Verify checks the token's signature, issuer, audience and lifetime and
+// returns the parsed ID token if everything checks out
+func (v *Verifier) Verify(ctx context.Context, rawToken string) (*IDToken, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	header := &tokenHeader{}
+	if err := json.Unmarshal(headerBytes, header); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if header.Alg != "RS256" {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	token := &IDToken{}
+	if err := json.Unmarshal(payload, token); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	return token, nil
+}
+
+func (v *Verifier) verifyClaims(claims *tokenClaims) error {
+	if !contains(v.issuers, claims.Iss) {
+		return ErrInvalidIssuer
+	}
+
+	matched := false
+	for _, aud := range claims.Aud {
+		if contains(v.audiences, aud) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return ErrInvalidAudience
+	}
+
+	now := v.now()
+	if now.After(time.Unix(claims.Exp, 0).Add(v.clockSkew)) {
+		return ErrTokenExpired
+	}
+
+	if now.Add(v.clockSkew).Before(time.Unix(claims.Iat, 0)) {
+		return ErrTokenIssuedInFuture
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
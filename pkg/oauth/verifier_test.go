@@ -0,0 +1,196 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Error signing token: %s\n", err.Error())
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksHandler(keys map[string]*rsa.PrivateKey, hits *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		*hits++
+
+		set := map[string][]map[string]string{"keys": {}}
+		for kid, key := range keys {
+			set["keys"] = append(set["keys"], map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %s\n", err.Error())
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %s\n", err.Error())
+	}
+
+	hits := 0
+	keys := map[string]*rsa.PrivateKey{"key-1": key}
+	srv := httptest.NewServer(jwksHandler(keys, &hits))
+	defer srv.Close()
+
+	now := time.Unix(1500000000, 0)
+	keySet := NewKeySet(srv.URL, srv.Client())
+	keySet.now = func() time.Time { return now }
+	verifier := NewVerifier(keySet,
+		WithIssuers("https://accounts.google.com"),
+		WithAudiences("client-id"),
+		WithClockSkew(time.Minute),
+	)
+	verifier.now = func() time.Time { return now }
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://accounts.google.com",
+			"aud":   "client-id",
+			"email": "foo@bar.com",
+			"iat":   now.Add(-time.Minute).Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+	}
+
+	testCases := []struct {
+		token       func() string
+		expectedErr error
+	}{
+		// Valid token verifies
+		{
+			token: func() string { return signToken(t, key, "key-1", validClaims()) },
+		},
+		// Audience can come as a list
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = []string{"other", "client-id"}
+				return signToken(t, key, "key-1", claims)
+			},
+		},
+		// Expired within the allowed skew still verifies
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = now.Add(-30 * time.Second).Unix()
+				return signToken(t, key, "key-1", claims)
+			},
+		},
+		// Not a JWT
+		{
+			token:       func() string { return "foo.bar" },
+			expectedErr: ErrMalformedToken,
+		},
+		// Signed by a key that isn't in the set
+		{
+			token:       func() string { return signToken(t, otherKey, "key-1", validClaims()) },
+			expectedErr: ErrInvalidSignature,
+		},
+		// Unknown key ID
+		{
+			token:       func() string { return signToken(t, key, "key-2", validClaims()) },
+			expectedErr: ErrKeyNotFound,
+		},
+		// Wrong issuer
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://evil.example.com"
+				return signToken(t, key, "key-1", claims)
+			},
+			expectedErr: ErrInvalidIssuer,
+		},
+		// Wrong audience
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "someone-else"
+				return signToken(t, key, "key-1", claims)
+			},
+			expectedErr: ErrInvalidAudience,
+		},
+		// Expired past the allowed skew
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = now.Add(-2 * time.Minute).Unix()
+				return signToken(t, key, "key-1", claims)
+			},
+			expectedErr: ErrTokenExpired,
+		},
+		// Issued in the future
+		{
+			token: func() string {
+				claims := validClaims()
+				claims["iat"] = now.Add(5 * time.Minute).Unix()
+				return signToken(t, key, "key-1", claims)
+			},
+			expectedErr: ErrTokenIssuedInFuture,
+		},
+	}
+
+	for i, testCase := range testCases {
+		token, err := verifier.Verify(context.Background(), testCase.token())
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v\n", i, testCase.expectedErr, err)
+			continue
+		}
+
+		if err == nil && token.Email != "foo@bar.com" {
+			t.Errorf("[%d] - Expected email foo@bar.com, got %s\n", i, token.Email)
+		}
+	}
+
+	// The key set is cached, and the unknown key ID didn't trigger a refetch
+	// this soon after the first one
+	if hits != 1 {
+		t.Errorf("Expected the key set to be fetched once, got %d\n", hits)
+	}
+
+	// Once the provider rotates in a new key, a token signed with it causes
+	// the set to be refetched
+	keys["key-2"] = otherKey
+	now = now.Add(2 * time.Minute)
+
+	if _, err := verifier.Verify(context.Background(), signToken(t, otherKey, "key-2", validClaims())); err != nil {
+		t.Errorf("Expected rotated key to verify, got %s\n", err.Error())
+	}
+
+	if hits != 2 {
+		t.Errorf("Expected the key set to be fetched twice, got %d\n", hits)
+	}
+}
@@ -0,0 +1,73 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+)
+
+var (
+	ErrIssuerMismatch      = errors.New("discovered issuer does not match the configured issuer")
+	ErrIncompleteDiscovery = errors.New("discovery document is missing required endpoints")
+)
+
+// Discovery is the part of a provider's OpenID configuration we use
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	// Not every provider supports the device flow
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// Discover fetches the issuer's OpenID configuration. The issuer in the
+// document has to be the one we asked for, or tokens it signs wouldn't
+// verify.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Discovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	req, err := http.NewRequest(http.MethodGet, issuer+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching OpenID configuration: %s", resp.Status)
+	}
+
+	discovery := &Discovery{}
+	if err := json.Unmarshal(body, discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, ErrIssuerMismatch
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, ErrIncompleteDiscovery
+	}
+
+	return discovery, nil
+}
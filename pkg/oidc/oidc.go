@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"go.uber.org/zap"
+	oauth2 "golang.org/x/oauth2"
+)
+
+var (
+	ErrIDTokenNotFound           = errors.New("id token not found in token response")
+	ErrCredentialFileUnsupported = errors.New("credential files are only supported with Google")
+)
+
+var (
+	// Asked for when no scopes are configured
+	defaultScopes = []string{"openid", "email"}
+)
+
+const (
+	// Asked for by the device flow, since most providers only hand out a
+	// refresh token with it
+	offlineAccessScope = "offline_access"
+)
+
+// Client is an oauth.Service for any OpenID Connect provider, with its
+// endpoints and signing keys found through discovery
+type Client struct {
+	client         *http.Client
+	logger         *zap.Logger
+	cfg            *oauth2.Config
+	stateGenerator func() string
+	verifier       *oauth.Verifier
+	provider       *oauth.Provider
+}
+
+// NewClient discovers the configured issuer's endpoints and creates a client
+// for it
+func NewClient(ctx context.Context, setOpts ...Option) (*Client, error) {
+	opts := defaultOptions()
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	discovery, err := Discover(ctx, opts.Client, opts.Config.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := withOpenID(opts.Config.Scopes)
+	endpoint := oauth2.Endpoint{
+		AuthURL:  discovery.AuthorizationEndpoint,
+		TokenURL: discovery.TokenEndpoint,
+	}
+
+	return &Client{
+		client: opts.Client,
+		logger: opts.Logger,
+		cfg: &oauth2.Config{
+			ClientID:     opts.Config.ClientID,
+			ClientSecret: opts.Config.ClientSecret,
+			Scopes:       scopes,
+			Endpoint:     endpoint,
+			RedirectURL:  opts.Config.RedirectURL,
+		},
+		stateGenerator: opts.Config.StateParameterGenerator,
+		verifier: oauth.NewVerifier(
+			oauth.NewKeySet(discovery.JWKSURI, opts.Client),
+			oauth.WithIssuers(discovery.Issuer),
+			oauth.WithAudiences(opts.Config.Audiences...),
+			oauth.WithClockSkew(opts.Config.ClockSkew),
+		),
+		provider: &oauth.Provider{
+			AuthURL:       endpoint.AuthURL,
+			TokenURL:      endpoint.TokenURL,
+			DeviceAuthURL: discovery.DeviceAuthorizationEndpoint,
+			ClientID:      opts.Config.DeviceClientID,
+			ClientSecret:  opts.Config.DeviceClientSecret,
+			Scopes:        withOfflineAccess(scopes),
+		},
+	}, nil
+}
+
+// NewLoginState generates the state, nonce and PKCE verifier for a login
+func (c *Client) NewLoginState() (*oauth.LoginState, error) {
+	return oauth.NewLoginState(c.stateGenerator)
+}
+
+// GetOAuthLoginURL returns the provider's login URL for the login
+func (c *Client) GetOAuthLoginURL(state *oauth.LoginState) string {
+	return c.cfg.AuthCodeURL(state.State,
+		oauth2.SetAuthURLParam("nonce", state.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", state.CodeChallenge()),
+		oauth2.SetAuthURLParam("code_challenge_method", oauth.PKCEMethod),
+	)
+}
+
+// Provider returns what clients need to log into the provider on their own
+func (c *Client) Provider() *oauth.Provider {
+	return c.provider
+}
+
+// Exchange exchanges a code for a verified ID token, checking it was issued
+// for the login
+func (c *Client) Exchange(ctx context.Context, code string, state *oauth.LoginState) (*oauth.IDToken, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.client)
+	tok, err := c.cfg.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", state.CodeVerifier))
+	if err != nil {
+		c.logger.Error("error exchanging OAuth code", zap.Error(err))
+		return nil, err
+	}
+
+	idToken, err := c.verifyToken(ctx, tok)
+	if err != nil {
+		c.logger.Error("error verifying id token", zap.Error(err))
+		return nil, err
+	}
+
+	if err := state.CheckNonce(idToken); err != nil {
+		c.logger.Error("id token nonce does not match", zap.String("email", idToken.Email))
+		return nil, err
+	}
+
+	return idToken, nil
+}
+
+// VerifyIDToken verifies an ID token the client got from the provider itself
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken string) (*oauth.IDToken, error) {
+	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		c.logger.Error("error verifying id token", zap.Error(err))
+		return nil, err
+	}
+
+	return idToken, nil
+}
+
+// TokenSourceFromCredentials isn't supported - only older clients logging in
+// with gcloud send credential files
+func (c *Client) TokenSourceFromCredentials(ctx context.Context, credentials []byte) (oauth2.TokenSource, error) {
+	return nil, ErrCredentialFileUnsupported
+}
+
+// IDToken verifies the ID token from the token source
+func (c *Client) IDToken(tokenSource oauth2.TokenSource) (*oauth.IDToken, error) {
+	token, err := tokenSource.Token()
+	if err != nil {
+		c.logger.Error("error getting token from source", zap.Error(err))
+		return nil, err
+	}
+
+	return c.verifyToken(context.Background(), token)
+}
+
+func (c *Client) verifyToken(ctx context.Context, token *oauth2.Token) (*oauth.IDToken, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrIDTokenNotFound
+	}
+
+	return c.verifier.Verify(ctx, rawIDToken)
+}
+
+// withOpenID makes sure the openid scope is asked for, without which there's
+// no ID token
+// withOfflineAccess adds offline_access to the scopes if it isn't there
+func withOfflineAccess(scopes []string) []string {
+	result := []string{}
+	for _, scope := range scopes {
+		if scope == offlineAccessScope {
+			return scopes
+		}
+		result = append(result, scope)
+	}
+	return append(result, offlineAccessScope)
+}
+
+func withOpenID(scopes []string) []string {
+	result := []string{}
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == "" {
+			continue
+		}
+		if scope == "openid" {
+			hasOpenID = true
+		}
+		result = append(result, scope)
+	}
+
+	if len(result) == 0 {
+		return defaultScopes
+	}
+	if !hasOpenID {
+		result = append([]string{"openid"}, result...)
+	}
+	return result
+}
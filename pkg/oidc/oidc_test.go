@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"go.uber.org/zap"
+)
+
+// fakeProvider is just enough of an OIDC provider to log in with. Codes are
+// only exchanged with the verifier they were issued for, and the ID token
+// carries whatever nonce the provider's been told to put in it.
+type fakeProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	issuer string
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %s\n", err.Error())
+	}
+
+	p := &fakeProvider{t: t, key: key}
+	p.srv = httptest.NewServer(p)
+	p.issuer = p.srv.URL
+	return p
+}
+
+func (p *fakeProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch req.URL.Path {
+	case discoveryPath:
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                        p.issuer,
+			"authorization_endpoint":        p.srv.URL + "/authorize",
+			"token_endpoint":                p.srv.URL + "/token",
+			"jwks_uri":                      p.srv.URL + "/keys",
+			"device_authorization_endpoint": p.srv.URL + "/device",
+		})
+	case "/keys":
+		json.NewEncoder(w).Encode(map[string][]map[string]string{
+			"keys": {{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	case "/token":
+		req.ParseForm()
+		if req.Form.Get("code") != "code" || req.Form.Get("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(p.srv.URL),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *fakeProvider) idToken(issuer string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key-1", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":            issuer,
+		"aud":            "client-id",
+		"sub":            "user",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          p.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		p.t.Fatalf("Error signing token: %s\n", err.Error())
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *fakeProvider) client(t *testing.T) *Client {
+	client, err := NewClient(context.Background(),
+		WithLogger(zap.NewNop()),
+		WithClient(p.srv.Client()),
+		WithConfig(config.OAuth{
+			IssuerURL:      p.srv.URL + "/",
+			ClientID:       "client-id",
+			ClientSecret:   "secret",
+			RedirectURL:    "https://sso.example.com/auth/callback",
+			Audiences:      []string{"client-id"},
+			ClockSkew:      time.Minute,
+			DeviceClientID: "device-client-id",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error creating client, got %v", err)
+	}
+	return client
+}
+
+func TestDiscover(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.srv.Close()
+
+	discovery, err := Discover(context.Background(), p.srv.Client(), p.srv.URL+"/")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if discovery.TokenEndpoint != p.srv.URL+"/token" || discovery.JWKSURI != p.srv.URL+"/keys" {
+		t.Errorf("Expected discovered endpoints, got %+v", discovery)
+	}
+
+	p.issuer = "https://someone-else.example.com"
+	if _, err := Discover(context.Background(), p.srv.Client(), p.srv.URL); err != ErrIssuerMismatch {
+		t.Errorf("Expected %v, got %v", ErrIssuerMismatch, err)
+	}
+
+	if _, err := Discover(context.Background(), p.srv.Client(), p.srv.URL+"/nothing-here"); err == nil {
+		t.Errorf("Expected error discovering a missing configuration")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.srv.Close()
+
+	client := p.client(t)
+	state := &oauth.LoginState{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+
+	loginURL, err := url.Parse(client.GetOAuthLoginURL(state))
+	if err != nil {
+		t.Fatalf("Expected a valid login URL, got %v", err)
+	}
+	if !strings.HasPrefix(loginURL.String(), p.srv.URL+"/authorize?") {
+		t.Errorf("Expected the discovered authorization endpoint, got %s", loginURL)
+	}
+	expectedParams := map[string]string{
+		"client_id":             "client-id",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        state.CodeChallenge(),
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for param, expected := range expectedParams {
+		if got := loginURL.Query().Get(param); got != expected {
+			t.Errorf("Expected %s=%s, got %s", param, expected, got)
+		}
+	}
+
+	testCases := []struct {
+		code          string
+		verifier      string
+		providerNonce string
+		expectedErr   error
+		expectErr     bool
+	}{
+		{code: "code", verifier: "verifier", providerNonce: "nonce"},
+		// The token has to be for this login
+		{code: "code", verifier: "verifier", providerNonce: "other", expectedErr: oauth.ErrNonceMismatch, expectErr: true},
+		// The provider refuses codes with the wrong verifier
+		{code: "code", verifier: "wrong", providerNonce: "nonce", expectErr: true},
+		{code: "wrong", verifier: "verifier", providerNonce: "nonce", expectErr: true},
+	}
+
+	for i, testCase := range testCases {
+		p.nonce = testCase.providerNonce
+		idToken, err := client.Exchange(context.Background(), testCase.code, &oauth.LoginState{
+			State:        "state",
+			Nonce:        "nonce",
+			CodeVerifier: testCase.verifier,
+		})
+
+		if (err != nil) != testCase.expectErr || (testCase.expectedErr != nil && err != testCase.expectedErr) {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+			continue
+		}
+		if err == nil && idToken.Email != "user@example.com" {
+			t.Errorf("[%d] - Expected user@example.com, got %s", i, idToken.Email)
+		}
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.srv.Close()
+
+	client := p.client(t)
+
+	if _, err := client.VerifyIDToken(context.Background(), p.idToken(p.srv.URL)); err != nil {
+		t.Errorf("Expected token from the issuer to verify, got %v", err)
+	}
+	if _, err := client.VerifyIDToken(context.Background(), p.idToken("https://accounts.google.com")); err != oauth.ErrInvalidIssuer {
+		t.Errorf("Expected %v, got %v", oauth.ErrInvalidIssuer, err)
+	}
+
+	provider := client.Provider()
+	if provider.DeviceAuthURL != p.srv.URL+"/device" || provider.ClientID != "device-client-id" {
+		t.Errorf("Expected discovered device endpoint and device client, got %+v", provider)
+	}
+	if !reflect.DeepEqual(provider.Scopes, []string{"openid", "email", "offline_access"}) {
+		t.Errorf("Expected the device flow to ask for offline access, got %v", provider.Scopes)
+	}
+}
+
+func TestWithOpenID(t *testing.T) {
+	testCases := []struct {
+		scopes   []string
+		expected []string
+	}{
+		{scopes: nil, expected: []string{"openid", "email"}},
+		{scopes: []string{""}, expected: []string{"openid", "email"}},
+		{scopes: []string{"email", "profile"}, expected: []string{"openid", "email", "profile"}},
+		{scopes: []string{"profile", "openid"}, expected: []string{"profile", "openid"}},
+	}
+
+	for i, testCase := range testCases {
+		if got := withOpenID(testCase.scopes); !reflect.DeepEqual(got, testCase.expected) {
+			t.Errorf("[%d] - Expected %v, got %v", i, testCase.expected, got)
+		}
+	}
+}
+
+func TestWithOfflineAccess(t *testing.T) {
+	testCases := []struct {
+		scopes   []string
+		expected []string
+	}{
+		{scopes: []string{"openid", "email"}, expected: []string{"openid", "email", "offline_access"}},
+		{scopes: []string{"openid", "offline_access"}, expected: []string{"openid", "offline_access"}},
+	}
+
+	for i, testCase := range testCases {
+		if got := withOfflineAccess(testCase.scopes); !reflect.DeepEqual(got, testCase.expected) {
+			t.Errorf("[%d] - Expected %v, got %v", i, testCase.expected, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package oidc
+
+import (
+	"net/http"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Options contains all Client options
+type Options struct {
+	Logger *zap.Logger
+	Client *http.Client
+	Config config.OAuth
+}
+
+// Option is a functional way of setting options for the Client
+type Option func(o *Options)
+
+// WithLogger sets logger on the Options struct
+func WithLogger(l *zap.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithConfig sets the OAuth configs on the Options struct
+func WithConfig(c config.OAuth) Option {
+	return func(o *Options) {
+		o.Config = c
+	}
+}
+
+// WithClient sets an HTTP client on the Options struct
+func WithClient(c *http.Client) Option {
+	return func(o *Options) {
+		o.Client = c
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Client: &http.Client{},
+		Logger: logging.Logger(),
+	}
+}
@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Effects a rule can have
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var (
+	ErrRuleNameNotSet = errors.New("rule name must be set")
+	ErrDuplicateRule  = errors.New("rule name is used more than once")
+	ErrInvalidEffect  = errors.New("effect must be allow or deny")
+)
+
+// Policy decides who can assume which role. It's loaded from a YAML file:
+//
+//	default: deny
+//	rules:
+//	  - name: contractors-no-prod
+//	    effect: deny
+//	    roles: ["arn:aws:iam::222222222222:role/*"]
+//	    match:
+//	      attributes:
+//	        department: Contractors
+//	  - name: engineering
+//	    effect: allow
+//	    match:
+//	      domains: [example.com]
+//	      groups: [eng@example.com]
+//	      org_units: [/Engineering]
+//	      hours: "08:00-20:00"
+//	      days: [mon, tue, wed, thu, fri]
+//	      timezone: America/Los_Angeles
+//
+// A deny rule that matches always wins. Otherwise an allow rule that
+// matches allows the role, and if nothing matches the default applies.
+type Policy struct {
+	Default string  `yaml:"default"`
+	Rules   []*Rule `yaml:"rules"`
+}
+
+// Request is what a policy is evaluated against
+type Request struct {
+	User    *directory.User
+	RoleARN string
+	Time    time.Time
+}
+
+// Decision is the outcome of evaluating a policy
+type Decision struct {
+	Allowed bool
+	// The rule that decided. Nil if no rule matched and the default applied.
+	Rule *Rule
+	// Explains the decision
+	Reason string
+	// Every rule that matched, in the order they're in the policy
+	Matched []*Rule
+}
+
+// Load reads and parses the policy file at the path
+func Load(path string) (*Policy, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(raw)
+}
+
+// Parse parses and validates a policy. Any mistake fails the whole policy,
+// so a typo can't quietly let someone in.
+func Parse(raw []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(raw, p); err != nil {
+		return nil, err
+	}
+
+	if p.Default == "" {
+		p.Default = EffectDeny
+	}
+	if p.Default != EffectAllow && p.Default != EffectDeny {
+		return nil, fmt.Errorf("default: %s", ErrInvalidEffect)
+	}
+
+	names := map[string]bool{}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: %s", i, ErrRuleNameNotSet)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q: %s", rule.Name, ErrDuplicateRule)
+		}
+		names[rule.Name] = true
+
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %q: %s", rule.Name, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Evaluate decides whether the user can assume the role
+func (p *Policy) Evaluate(req *Request) *Decision {
+	decision := &Decision{}
+
+	var allowedBy, deniedBy *Rule
+	for _, rule := range p.Rules {
+		if !rule.Matches(req) {
+			continue
+		}
+		decision.Matched = append(decision.Matched, rule)
+
+		if rule.Effect == EffectDeny && deniedBy == nil {
+			deniedBy = rule
+		}
+		if rule.Effect == EffectAllow && allowedBy == nil {
+			allowedBy = rule
+		}
+	}
+
+	switch {
+	case deniedBy != nil:
+		decision.Rule = deniedBy
+		decision.Reason = fmt.Sprintf("denied by rule %q", deniedBy.Name)
+	case allowedBy != nil:
+		decision.Allowed = true
+		decision.Rule = allowedBy
+		decision.Reason = fmt.Sprintf("allowed by rule %q", allowedBy.Name)
+	default:
+		decision.Allowed = p.Default == EffectAllow
+		decision.Reason = fmt.Sprintf("no rule matched, default is %s", p.Default)
+	}
+
+	return decision
+}
+
+// matchGlob matches the value against a pattern where * matches anything,
+// including the slashes in role paths
+func matchGlob(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
@@ -0,0 +1,208 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+)
+
+const (
+	prodAdmin    = "arn:aws:iam::222222222222:role/admin"
+	prodReadonly = "arn:aws:iam::222222222222:role/ops/readonly"
+	devAdmin     = "arn:aws:iam::111111111111:role/admin"
+)
+
+const testPolicy = `
+rules:
+  - name: contractors-no-prod
+    effect: deny
+    roles: ["arn:aws:iam::222222222222:role/*"]
+    match:
+      attributes:
+        department: Contractors
+  - name: engineering
+    effect: allow
+    match:
+      domains: [example.com]
+      org_units: [/Engineering]
+  - name: oncall-prod
+    effect: allow
+    roles: ["arn:aws:iam::222222222222:role/*"]
+    match:
+      groups: [oncall@example.com]
+  - name: no-prod-admin-after-hours
+    effect: deny
+    roles: ["` + prodAdmin + `"]
+    match:
+      hours: "08:00-18:00"
+      days: [sat, sun]
+      timezone: America/New_York
+  - name: night-freeze
+    effect: deny
+    roles: ["*:role/admin"]
+    match:
+      emails: [bob@example.com]
+      hours: "22:00-06:00"
+`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	engineer := &directory.User{
+		Email:      "alice@example.com",
+		Attributes: map[string]string{directory.AttributeOrgUnitPath: "/Engineering/Platform"},
+	}
+	contractor := &directory.User{
+		Email:  "carol@example.com",
+		Groups: []string{"OnCall@example.com"},
+		Attributes: map[string]string{
+			directory.AttributeOrgUnitPath: "/Engineering",
+			directory.AttributeDepartment:  "Contractors",
+		},
+	}
+	oncall := &directory.User{
+		Email:  "bob@example.com",
+		Groups: []string{"oncall@example.com"},
+	}
+
+	// A Wednesday and a Saturday, at noon in New York
+	weekday := time.Date(2019, 3, 6, 17, 0, 0, 0, time.UTC)
+	weekend := time.Date(2019, 3, 9, 17, 0, 0, 0, time.UTC)
+	night := time.Date(2019, 3, 6, 23, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		user     *directory.User
+		role     string
+		time     time.Time
+		expected bool
+		rule     string
+	}{
+		{user: engineer, role: prodAdmin, time: weekday, expected: true, rule: "engineering"},
+		// Deny wins over the allow that also matches
+		{user: contractor, role: prodReadonly, time: weekday, expected: false, rule: "contractors-no-prod"},
+		{user: contractor, role: devAdmin, time: weekday, expected: true, rule: "engineering"},
+		{user: engineer, role: prodAdmin, time: weekend, expected: false, rule: "no-prod-admin-after-hours"},
+		{user: engineer, role: prodReadonly, time: weekend, expected: true, rule: "engineering"},
+		{user: oncall, role: prodReadonly, time: weekday, expected: true, rule: "oncall-prod"},
+		{user: oncall, role: prodAdmin, time: night, expected: false, rule: "night-freeze"},
+		// Nothing matches, so the default of deny applies
+		{user: oncall, role: devAdmin, time: weekday, expected: false},
+	}
+
+	for i, tc := range testCases {
+		decision := p.Evaluate(&Request{User: tc.user, RoleARN: tc.role, Time: tc.time})
+		if decision.Allowed != tc.expected {
+			t.Errorf("[%d] - Expected allowed to be %t, got %t (%s)", i, tc.expected, decision.Allowed, decision.Reason)
+		}
+
+		rule := ""
+		if decision.Rule != nil {
+			rule = decision.Rule.Name
+		}
+		if rule != tc.rule {
+			t.Errorf("[%d] - Expected rule %q, got %q", i, tc.rule, rule)
+		}
+	}
+
+	// Everything that matched is listed, not just the rule that decided
+	decision := p.Evaluate(&Request{User: contractor, RoleARN: prodReadonly, Time: weekday})
+	if len(decision.Matched) != 3 {
+		t.Errorf("Expected 3 matching rules, got %d", len(decision.Matched))
+	}
+}
+
+func TestDefaultAllow(t *testing.T) {
+	p, err := Parse([]byte("default: allow"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	decision := p.Evaluate(&Request{User: &directory.User{Email: "alice@example.com"}, RoleARN: devAdmin})
+	if !decision.Allowed || decision.Rule != nil {
+		t.Errorf("Expected the default to allow, got %+v", decision)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []string{
+		"default: maybe",
+		// Missing name
+		`
+rules:
+  - effect: allow
+`,
+		`
+rules:
+  - name: a
+    effect: allow
+  - name: a
+    effect: deny
+`,
+		`
+rules:
+  - name: a
+    effect: permit
+`,
+		`
+rules:
+  - name: a
+    effect: allow
+    match:
+      hours: "9-5"
+`,
+		`
+rules:
+  - name: a
+    effect: allow
+    match:
+      days: [someday]
+`,
+		`
+rules:
+  - name: a
+    effect: allow
+    match:
+      timezone: Nowhere/Special
+`,
+		// Typos in field names
+		`
+rules:
+  - name: a
+    effect: allow
+    match:
+      group: [ops@example.com]
+`,
+	}
+
+	for i, tc := range testCases {
+		if _, err := Parse([]byte(tc)); err == nil {
+			t.Errorf("[%d] - Expected error, got none", i)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		value    string
+		expected bool
+	}{
+		{pattern: prodAdmin, value: prodAdmin, expected: true},
+		{pattern: prodAdmin, value: devAdmin, expected: false},
+		{pattern: "*", value: prodReadonly, expected: true},
+		{pattern: "arn:aws:iam::222222222222:role/*", value: prodReadonly, expected: true},
+		{pattern: "arn:aws:iam::*:role/admin", value: devAdmin, expected: true},
+		{pattern: "arn:aws:iam::*:role/admin", value: prodReadonly, expected: false},
+		{pattern: "*admin*admin", value: "admin", expected: false},
+	}
+
+	for i, tc := range testCases {
+		if matched := matchGlob(tc.pattern, tc.value); matched != tc.expected {
+			t.Errorf("[%d] - Expected %t matching %q against %q, got %t", i, tc.expected, tc.pattern, tc.value, matched)
+		}
+	}
+}
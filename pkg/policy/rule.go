@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+)
+
+var (
+	ErrInvalidHours = errors.New("hours must be in the format HH:MM-HH:MM")
+	ErrInvalidDay   = errors.New("days must be mon, tue, wed, thu, fri, sat or sun")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Rule allows or denies roles to the users it matches
+type Rule struct {
+	Name   string `yaml:"name"`
+	Effect string `yaml:"effect"`
+	// Role ARNs the rule applies to, where * matches anything. Empty means
+	// every role.
+	Roles []string `yaml:"roles"`
+	Match Match    `yaml:"match"`
+}
+
+// Match is what a rule matches on. Every condition that's set has to match,
+// and a condition with a list matches if any item in it does. An empty
+// Match matches everyone.
+type Match struct {
+	Emails  []string `yaml:"emails"`
+	Domains []string `yaml:"domains"`
+	Groups  []string `yaml:"groups"`
+	// The user's org unit path or any of its parents, e.g. /Engineering
+	// matches /Engineering/Platform
+	OrgUnits   []string          `yaml:"org_units"`
+	Attributes map[string]string `yaml:"attributes"`
+	// Time of day, e.g. 09:00-17:00. Ranges that end before they start wrap
+	// past midnight.
+	Hours string `yaml:"hours"`
+	// Days of the week, e.g. [mon, tue]
+	Days []string `yaml:"days"`
+	// Zone the hours and days are in. Defaults to UTC.
+	Timezone string `yaml:"timezone"`
+
+	// Minutes since midnight, parsed from Hours
+	start, end int
+	location   *time.Location
+}
+
+func (r *Rule) compile() error {
+	if r.Effect != EffectAllow && r.Effect != EffectDeny {
+		return ErrInvalidEffect
+	}
+	return r.Match.compile()
+}
+
+func (m *Match) compile() error {
+	m.location = time.UTC
+	if m.Timezone != "" {
+		location, err := time.LoadLocation(m.Timezone)
+		if err != nil {
+			return err
+		}
+		m.location = location
+	}
+
+	for _, day := range m.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return ErrInvalidDay
+		}
+	}
+
+	if m.Hours == "" {
+		return nil
+	}
+
+	parts := strings.Split(m.Hours, "-")
+	if len(parts) != 2 {
+		return ErrInvalidHours
+	}
+
+	var err error
+	if m.start, err = parseClock(parts[0]); err != nil {
+		return err
+	}
+	if m.end, err = parseClock(parts[1]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, ErrInvalidHours
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Matches checks whether the rule applies to the request
+func (r *Rule) Matches(req *Request) bool {
+	return r.matchesRole(req.RoleARN) && r.Match.matches(req.User, req.Time)
+}
+
+func (r *Rule) matchesRole(arn string) bool {
+	if len(r.Roles) == 0 {
+		return true
+	}
+	for _, pattern := range r.Roles {
+		if matchGlob(pattern, arn) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Match) matches(user *directory.User, now time.Time) bool {
+	if len(m.Emails) > 0 && !containsFold(m.Emails, user.Email) {
+		return false
+	}
+
+	if len(m.Domains) > 0 && !containsFold(m.Domains, domain(user.Email)) {
+		return false
+	}
+
+	if len(m.Groups) > 0 && !intersectsFold(m.Groups, user.Groups) {
+		return false
+	}
+
+	if len(m.OrgUnits) > 0 && !m.matchesOrgUnit(user.Attributes[directory.AttributeOrgUnitPath]) {
+		return false
+	}
+
+	for key, value := range m.Attributes {
+		if user.Attributes[key] != value {
+			return false
+		}
+	}
+
+	return m.matchesTime(now)
+}
+
+func (m *Match) matchesOrgUnit(path string) bool {
+	if path == "" {
+		return false
+	}
+	for _, orgUnit := range m.OrgUnits {
+		orgUnit = strings.TrimSuffix(orgUnit, "/")
+		if orgUnit == "" || path == orgUnit || strings.HasPrefix(path, orgUnit+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Match) matchesTime(now time.Time) bool {
+	if m.Hours == "" && len(m.Days) == 0 {
+		return true
+	}
+
+	now = now.In(m.location)
+	if len(m.Days) > 0 {
+		matched := false
+		for _, day := range m.Days {
+			if weekdays[strings.ToLower(day)] == now.Weekday() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if m.Hours == "" {
+		return true
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	if m.start <= m.end {
+		return minute >= m.start && minute < m.end
+	}
+	return minute >= m.start || minute < m.end
+}
+
+// String describes the conditions the match checks, for explaining decisions
+func (m *Match) String() string {
+	conditions := []string{}
+	add := func(name string, values []string) {
+		if len(values) > 0 {
+			conditions = append(conditions, fmt.Sprintf("%s in [%s]", name, strings.Join(values, ", ")))
+		}
+	}
+
+	add("email", m.Emails)
+	add("domain", m.Domains)
+	add("group", m.Groups)
+	add("org unit", m.OrgUnits)
+	keys := []string{}
+	for key := range m.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", key, m.Attributes[key]))
+	}
+	add("day", m.Days)
+	if m.Hours != "" {
+		conditions = append(conditions, fmt.Sprintf("hours %s %s", m.Hours, m.location))
+	}
+
+	if len(conditions) == 0 {
+		return "everyone"
+	}
+	return strings.Join(conditions, " and ")
+}
+
+func domain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersectsFold(a, b []string) bool {
+	for _, item := range b {
+		if containsFold(a, item) {
+			return true
+		}
+	}
+	return false
+}
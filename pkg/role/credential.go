@@ -1,7 +1,16 @@
 package role
 
-// Credential wraps the format of a credential
+import "time"
+
+// Credential is a set of temporary credentials for a role
 type Credential struct {
-	Raw      []byte
-	Location string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+	// Region the credentials are meant to be used in
+	Region string
+	// ARN of the assumed role session, which is what shows up in CloudTrail
+	RoleARN   string
+	AccountID string
 }
@@ -0,0 +1,16 @@
+package role
+
+import "time"
+
+// Request wraps everything needed to get a credential for a role
+type Request struct {
+	// ARN of the role to assume
+	RoleARN string
+	// How long the credential should be valid for. Zero uses the provider's default.
+	Duration time.Duration
+	// Email of the user the credential is for, so the session can be traced
+	// back to them
+	Email string
+	// Directory attributes of the user, which can be attached to the session
+	Attributes map[string]string
+}
@@ -1,9 +1,8 @@
 package role
 
-// Service is an interface that implements getting credentials and
-// seeds them in the right location
+// Service is an interface that implements getting credentials for a role
 type Service interface {
-	// GetCredential takes a role identifier and returns a wrapped credential object,
-	// which is the credential in the file format, and the location of where to seed it
-	GetCredential(roleID string) (*Credential, error)
+	// GetCredential takes a role request and returns the temporary credentials
+	// for the role
+	GetCredential(req *Request) (*Credential, error)
 }
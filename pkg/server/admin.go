@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// InvalidateUserHandler drops a user from the directory cache, so changes
+// made to them in the directory are picked up on their next request
+func (s *Server) InvalidateUserHandler(w http.ResponseWriter, req *http.Request) {
+	if !s.authorizeAdmin(w, req) {
+		return
+	}
+
+	invalidator, ok := s.directorySvc.(directory.Invalidator)
+	if !ok {
+		httphelper.JSONResponse(w, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeCacheDisabled,
+			Message: "directory lookups aren't cached",
+		}, http.StatusNotFound)
+		return
+	}
+
+	email := mux.Vars(req)["email"]
+	httphelper.JSONResponse(w, &handlers.InvalidateUserResponse{
+		Email:       email,
+		Invalidated: invalidator.Invalidate(email),
+	}, http.StatusOK)
+}
+
+// authorizeAdmin checks the request carries the admin token. Without a token
+// configured, the admin endpoints don't exist.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, req *http.Request) bool {
+	if len(s.adminToken) == 0 {
+		httphelper.JSONResponse(w, struct{}{}, http.StatusNotFound)
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(bearerToken(req)), s.adminToken) != 1 {
+		s.logger.Warn("admin request with a bad token", zap.String("remote", req.RemoteAddr), zap.String("path", req.URL.Path))
+		httphelper.JSONResponse(w, struct{}{}, http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
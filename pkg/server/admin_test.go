@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory/cache"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// staticDirectory knows one user
+type staticDirectory struct{}
+
+func (staticDirectory) GetUser(email string) (*directory.User, error) {
+	return &directory.User{Email: email}, nil
+}
+
+func TestInvalidateUserHandler(t *testing.T) {
+	cached := cache.New(staticDirectory{}, cache.WithLogger(zap.NewNop()))
+	cached.GetUser("alice@example.com")
+
+	testCases := []struct {
+		directory      directory.Service
+		adminToken     string
+		token          string
+		expectedStatus int
+	}{
+		{directory: cached, adminToken: "admin", token: "admin", expectedStatus: http.StatusOK},
+		{directory: cached, adminToken: "admin", token: "wrong", expectedStatus: http.StatusUnauthorized},
+		// Admin endpoints are off without a token
+		{directory: cached, token: "", expectedStatus: http.StatusNotFound},
+		{directory: staticDirectory{}, adminToken: "admin", token: "admin", expectedStatus: http.StatusNotFound},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			logger:       zap.NewNop(),
+			directorySvc: testCase.directory,
+			adminToken:   []byte(testCase.adminToken),
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/admin/directory/users/{email}", s.InvalidateUserHandler).Methods("DELETE")
+
+		req := httptest.NewRequest("DELETE", "/admin/directory/users/alice@example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.token)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != testCase.expectedStatus {
+			t.Errorf("[%d] - Expected status %d, got %d", i, testCase.expectedStatus, w.Code)
+		}
+	}
+
+	if cached.Invalidate("alice@example.com") {
+		t.Errorf("Expected alice to have been invalidated")
+	}
+}
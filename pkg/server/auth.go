@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+)
+
+const (
+	bearerPrefix = "Bearer "
+)
+
+var (
+	ErrNoCredentials         = errors.New("request has no bearer token")
+	ErrCredentialFileRefused = errors.New("credential file requests are no longer accepted")
+)
+
+// verifyCaller works out who's calling from the ID token in the
+// Authorization header. Older clients send their whole gcloud credentials
+// file instead, which is accepted until that's turned off.
+func (s *Server) verifyCaller(req *http.Request, request *handlers.CredentialHandlerRequest) (*oauth.IDToken, error) {
+	if rawIDToken := bearerToken(req); rawIDToken != "" {
+		return s.oAuthSvc.VerifyIDToken(req.Context(), rawIDToken)
+	}
+
+	if len(request.CredentialFile) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	if !s.identityPolicy.AllowCredentialFile {
+		return nil, ErrCredentialFileRefused
+	}
+
+	s.logger.Warn("client sent a credential file, which is deprecated - it should be upgraded to send an ID token",
+		zap.String("remote", req.RemoteAddr),
+		zap.String("user_agent", req.UserAgent()))
+
+	tokenSource, err := s.oAuthSvc.TokenSourceFromCredentials(context.Background(), request.CredentialFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.oAuthSvc.IDToken(tokenSource)
+}
+
+// bearerToken returns the token in the Authorization header, if there is one
+func bearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(bearerPrefix):])
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// fakeOAuth hands out an ID token for the one token and credential file it
+// knows about
+type fakeOAuth struct {
+	oauth.Service
+}
+
+func (f *fakeOAuth) VerifyIDToken(ctx context.Context, rawIDToken string) (*oauth.IDToken, error) {
+	if rawIDToken != "good-token" {
+		return nil, oauth.ErrInvalidSignature
+	}
+	return &oauth.IDToken{Email: "bearer@example.com"}, nil
+}
+
+func (f *fakeOAuth) TokenSourceFromCredentials(ctx context.Context, credentials []byte) (oauth2.TokenSource, error) {
+	if string(credentials) != "good-file" {
+		return nil, errors.New("bad credentials")
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{}), nil
+}
+
+func (f *fakeOAuth) IDToken(oauth2.TokenSource) (*oauth.IDToken, error) {
+	return &oauth.IDToken{Email: "file@example.com"}, nil
+}
+
+func TestVerifyCaller(t *testing.T) {
+	testCases := []struct {
+		authorization       string
+		credentialFile      string
+		allowCredentialFile bool
+		expectedEmail       string
+		expectedErr         error
+	}{
+		// Bearer tokens are verified
+		{authorization: "Bearer good-token", expectedEmail: "bearer@example.com"},
+		{authorization: "bearer good-token", expectedEmail: "bearer@example.com"},
+		{authorization: "Bearer bad-token", expectedErr: oauth.ErrInvalidSignature},
+		// Bearer tokens win over credential files
+		{authorization: "Bearer good-token", credentialFile: "good-file", allowCredentialFile: true, expectedEmail: "bearer@example.com"},
+		// Credential files are only accepted while allowed
+		{credentialFile: "good-file", allowCredentialFile: true, expectedEmail: "file@example.com"},
+		{credentialFile: "good-file", expectedErr: ErrCredentialFileRefused},
+		// Nothing to go on
+		{expectedErr: ErrNoCredentials},
+		{authorization: "Basic dXNlcjpwYXNz", expectedErr: ErrNoCredentials},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			logger:         zap.NewNop(),
+			oAuthSvc:       &fakeOAuth{},
+			identityPolicy: config.Identity{AllowCredentialFile: testCase.allowCredentialFile},
+		}
+
+		req := httptest.NewRequest("POST", "/credentials", nil)
+		if testCase.authorization != "" {
+			req.Header.Set("Authorization", testCase.authorization)
+		}
+
+		idToken, err := s.verifyCaller(req, &handlers.CredentialHandlerRequest{CredentialFile: []byte(testCase.credentialFile)})
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+			continue
+		}
+		if err == nil && idToken.Email != testCase.expectedEmail {
+			t.Errorf("[%d] - Expected %s, got %s", i, testCase.expectedEmail, idToken.Email)
+		}
+	}
+}
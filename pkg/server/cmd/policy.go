@@ -0,0 +1,114 @@
+package servercmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	policyPath       string
+	policyEmail      string
+	policyRole       string
+	policyGroups     []string
+	policyOrgUnit    string
+	policyAttributes []string
+	policyTime       string
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with the role policy",
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Check whether a user can assume a role, without looking them up in the directory",
+	Run:   testPolicy,
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyTestCmd)
+	policyTestCmd.Flags().StringVar(&policyPath, "file", "", "Path to the policy file. Defaults to POLICY_PATH.")
+	policyTestCmd.Flags().StringVar(&policyEmail, "email", "", "Email of the user")
+	policyTestCmd.Flags().StringVar(&policyRole, "role", "", "ARN of the role the user is assuming")
+	policyTestCmd.Flags().StringArrayVar(&policyGroups, "group", nil, "Group the user is in. Can be repeated.")
+	policyTestCmd.Flags().StringVar(&policyOrgUnit, "org-unit", "", "Org unit path of the user, e.g. /Engineering")
+	policyTestCmd.Flags().StringArrayVar(&policyAttributes, "attribute", nil, "Directory attribute of the user as key=value. Can be repeated.")
+	policyTestCmd.Flags().StringVar(&policyTime, "time", "", "When the role is assumed, in RFC 3339. Defaults to now.")
+}
+
+// testPolicy evaluates the policy for the user and role given on the command
+// line and explains the decision. It exits non-zero if the role is denied.
+func testPolicy(cmd *cobra.Command, args []string) {
+	if policyEmail == "" || policyRole == "" {
+		logging.Logger().Fatal("--email and --role must be set")
+	}
+
+	if policyPath == "" {
+		policyPath = config.Get().Policy.Path
+	}
+	if policyPath == "" {
+		logging.Logger().Fatal("no policy file, set --file or POLICY_PATH")
+	}
+
+	p, err := policy.Load(policyPath)
+	if err != nil {
+		logging.Logger().Fatal("error loading policy", zap.String("path", policyPath), zap.Error(err))
+	}
+
+	now := time.Now()
+	if policyTime != "" {
+		if now, err = time.Parse(time.RFC3339, policyTime); err != nil {
+			logging.Logger().Fatal("error parsing time", zap.Error(err))
+		}
+	}
+
+	user := &directory.User{
+		Email:      policyEmail,
+		Groups:     policyGroups,
+		Attributes: map[string]string{},
+	}
+	for _, attribute := range policyAttributes {
+		parts := strings.SplitN(attribute, "=", 2)
+		if len(parts) != 2 {
+			logging.Logger().Fatal("attributes must be key=value", zap.String("attribute", attribute))
+		}
+		user.Attributes[parts[0]] = parts[1]
+	}
+	if policyOrgUnit != "" {
+		user.Attributes[directory.AttributeOrgUnitPath] = policyOrgUnit
+	}
+
+	decision := p.Evaluate(&policy.Request{User: user, RoleARN: policyRole, Time: now})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	result := "DENY"
+	if decision.Allowed {
+		result = "ALLOW"
+	}
+	fmt.Fprintf(w, "Decision:\t%s\n", result)
+	fmt.Fprintf(w, "Reason:\t%s\n", decision.Reason)
+	for _, rule := range decision.Matched {
+		roles := "any role"
+		if len(rule.Roles) > 0 {
+			roles = strings.Join(rule.Roles, ", ")
+		}
+		fmt.Fprintf(w, "Matched:\t%s (%s): %s, for %s\n", rule.Name, rule.Effect, rule.Match.String(), roles)
+	}
+	w.Flush()
+
+	if !decision.Allowed {
+		os.Exit(1)
+	}
+}
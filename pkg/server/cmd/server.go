@@ -1,14 +1,24 @@
 package servercmd
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/aws"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory/cache"
 	gdirectory "github.com/catherinetcai/gsuite-aws-sso/pkg/gsuite/directory"
 	goauth "github.com/catherinetcai/gsuite-aws-sso/pkg/gsuite/oauth"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/http/middleware"
+	ldirectory "github.com/catherinetcai/gsuite-aws-sso/pkg/ldap/directory"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oidc"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/server"
+	sdirectory "github.com/catherinetcai/gsuite-aws-sso/pkg/static/directory"
 	"github.com/gorilla/mux"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -27,27 +37,37 @@ func init() {
 }
 
 func runServer(cmd *cobra.Command, args []string) {
-	oauthClient := goauth.NewClient(
-		goauth.WithLogger(logger),
-		goauth.WithConfig(config.Get().OAuth),
-	)
+	oauthClient, err := newOAuthService(config.Get().OAuth)
+	if err != nil {
+		logging.Logger().Fatal("failed to initialize oauth", zap.Error(err))
+	}
 
-	directoryClient, err := gdirectory.NewClient(
-		gdirectory.WithLogger(logger),
-		gdirectory.WithImpersonationEmail(config.Get().GSuite.ImpersonationEmail),
-		gdirectory.WithServiceAccountEmail(config.Get().GSuite.ServiceAccountEmail),
-		// TODO: Make this flexible with both the base64 or a file path
-		gdirectory.WithServiceAccountBase64EncodedFile(config.Get().GSuite.ServiceAccountBase64EncodedFile),
-	)
+	directoryClient, err := newDirectoryService(config.Get())
 	if err != nil {
 		logging.Logger().Fatal("failed to initialize directory", zap.Error(err))
 	}
 
-	awsClient := aws.New(session.Must(session.NewSession()))
-	if err != nil {
-		logging.Logger().Fatal("failed to initialize aws", zap.Error(err))
+	if dirCfg := config.Get().Directory; dirCfg.CacheTTL > 0 || dirCfg.CacheNegativeTTL > 0 {
+		directoryClient = cache.New(directoryClient,
+			cache.WithLogger(logger),
+			cache.WithTTL(dirCfg.CacheTTL),
+			cache.WithNegativeTTL(dirCfg.CacheNegativeTTL),
+		)
+	}
+
+	var rolePolicy *policy.Policy
+	if path := config.Get().Policy.Path; path != "" {
+		rolePolicy, err = policy.Load(path)
+		if err != nil {
+			logging.Logger().Fatal("failed to load policy", zap.String("path", path), zap.Error(err))
+		}
 	}
 
+	awsClient := aws.New(session.Must(session.NewSession()),
+		aws.WithSessionTags(config.Get().AWS.SessionTags),
+		aws.WithSourceIdentity(config.Get().AWS.SourceIdentity),
+	)
+
 	// TODO: Need to handle any unmatched routes
 	router := mux.NewRouter()
 	router.Use(middleware.NewLogging(logging.Logger()).Middleware)
@@ -59,6 +79,11 @@ func runServer(cmd *cobra.Command, args []string) {
 		server.WithOAuth(oauthClient),
 		server.WithDirectory(directoryClient),
 		server.WithRole(awsClient),
+		server.WithIdentityPolicy(config.Get().Identity),
+		server.WithRolePolicy(rolePolicy),
+		server.WithSessionDuration(config.Get().AWS.SessionDuration),
+		server.WithCookieKey([]byte(config.Get().Server.CookieSecret)),
+		server.WithAdminToken([]byte(config.Get().Server.AdminToken)),
 	)
 	if err != nil {
 		logging.Logger().Fatal("failed to start server", zap.Error(err))
@@ -66,3 +91,75 @@ func runServer(cmd *cobra.Command, args []string) {
 
 	logging.Logger().Fatal("error running", zap.Error(s.Run()))
 }
+
+// newOAuthService creates the client for the configured identity provider
+func newOAuthService(cfg config.OAuth) (oauth.Service, error) {
+	switch cfg.Provider {
+	case config.OAuthProviderGoogle, "":
+		return goauth.NewClient(
+			goauth.WithLogger(logger),
+			goauth.WithConfig(cfg),
+		), nil
+	case config.OAuthProviderOIDC:
+		return oidc.NewClient(context.Background(),
+			oidc.WithLogger(logger),
+			oidc.WithConfig(cfg),
+		)
+	default:
+		return nil, fmt.Errorf("unknown oauth provider %q", cfg.Provider)
+	}
+}
+
+// newDirectoryService creates the configured directory users are looked up in
+func newDirectoryService(cfg *config.Config) (directory.Service, error) {
+	switch cfg.Directory.Provider {
+	case config.DirectoryProviderGSuite, "":
+		return gdirectory.NewClient(
+			gdirectory.WithLogger(logger),
+			gdirectory.WithImpersonationEmail(cfg.GSuite.ImpersonationEmail),
+			gdirectory.WithServiceAccountEmail(cfg.GSuite.ServiceAccountEmail),
+			// TODO: Make this flexible with both the base64 or a file path
+			gdirectory.WithServiceAccountBase64EncodedFile(cfg.GSuite.ServiceAccountBase64EncodedFile),
+			gdirectory.WithGroupRoles(cfg.GSuite.GroupRoles),
+			// Policies can match on groups
+			gdirectory.WithGroupLookup(cfg.Policy.Path != ""),
+		)
+	case config.DirectoryProviderFile:
+		client, err := sdirectory.NewClient(
+			sdirectory.WithLogger(logger),
+			sdirectory.WithPath(cfg.Directory.Path),
+			sdirectory.WithReloadInterval(cfg.Directory.ReloadInterval),
+		)
+		if err != nil {
+			return nil, err
+		}
+		// Reloads for as long as the server runs, unless turned off
+		if cfg.Directory.ReloadInterval > 0 {
+			go client.Run(make(chan struct{}))
+		}
+		return client, nil
+	case config.DirectoryProviderLDAP:
+		ldapCfg := cfg.Directory.LDAP
+		tlsConfig, err := ldirectory.TLSConfig(ldapCfg.CAFile, ldapCfg.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		return ldirectory.NewClient(
+			ldirectory.WithLogger(logger),
+			ldirectory.WithURL(ldapCfg.URL),
+			ldirectory.WithStartTLS(ldapCfg.StartTLS),
+			ldirectory.WithTLSConfig(tlsConfig),
+			ldirectory.WithBind(ldapCfg.BindDN, ldapCfg.BindPassword),
+			ldirectory.WithBaseDN(ldapCfg.BaseDN),
+			ldirectory.WithUserFilter(ldapCfg.UserFilter),
+			ldirectory.WithRoleAttribute(ldapCfg.RoleAttribute),
+			ldirectory.WithGroupAttribute(ldapCfg.GroupAttribute),
+			ldirectory.WithGroupSearch(ldapCfg.GroupBaseDN, ldapCfg.GroupFilter),
+			ldirectory.WithGroupRoles(ldapCfg.GroupRoles),
+			ldirectory.WithAttributes(ldapCfg.Attributes),
+			ldirectory.WithPoolSize(ldapCfg.PoolSize),
+		)
+	default:
+		return nil, fmt.Errorf("unknown directory provider %q", cfg.Directory.Provider)
+	}
+}
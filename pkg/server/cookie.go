@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// Holds the login's state between the redirect to the provider and the
+	// callback
+	loginCookieName = "gsuite_aws_sso_login"
+	// How long the user has to get through the provider's login. Never
+	// outlives the login session itself.
+	loginCookieTTL = 5 * time.Minute
+	// Holds the token the login confirmation form has to post back, so the
+	// form can only be posted from the page that showed it
+	confirmCookieName = "gsuite_aws_sso_confirm"
+)
+
+var (
+	errInvalidCookie = errors.New("invalid login cookie")
+	errCookieExpired = errors.New("login cookie expired")
+)
+
+// loginCookie is what the browser carries through the provider's login. It's
+// signed so it can't be tampered with, but isn't encrypted - nothing in it
+// is any use without the browser it was handed to.
+type loginCookie struct {
+	Session      string `json:"session"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Expires      int64  `json:"expires"`
+}
+
+// signCookie encodes the cookie as <payload>.<signature>
+func signCookie(key []byte, cookie *loginCookie) (string, error) {
+	payload, err := json.Marshal(cookie)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(key, encoded)), nil
+}
+
+// verifyCookie checks the cookie's signature and expiry, and decodes it
+func verifyCookie(key []byte, value string, now time.Time) (*loginCookie, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, errInvalidCookie
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, cookieMAC(key, parts[0])) {
+		return nil, errInvalidCookie
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+
+	cookie := &loginCookie{}
+	if err := json.Unmarshal(payload, cookie); err != nil {
+		return nil, errInvalidCookie
+	}
+
+	if !now.Before(time.Unix(cookie.Expires, 0)) {
+		return nil, errCookieExpired
+	}
+
+	return cookie, nil
+}
+
+func cookieMAC(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
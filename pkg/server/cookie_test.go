@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginCookie(t *testing.T) {
+	key := []byte("key")
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	signed, err := signCookie(key, &loginCookie{
+		Session:      "session",
+		State:        "state",
+		Nonce:        "nonce",
+		CodeVerifier: "verifier",
+		Expires:      now.Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error signing cookie, got %v", err)
+	}
+
+	testCases := []struct {
+		key         []byte
+		value       string
+		now         time.Time
+		expectedErr error
+	}{
+		{key: key, value: signed, now: now},
+		// Signed with another key
+		{key: []byte("other"), value: signed, now: now, expectedErr: errInvalidCookie},
+		// Tampered with
+		{key: key, value: "e30." + signed[len(signed)-43:], now: now, expectedErr: errInvalidCookie},
+		{key: key, value: signed + "x", now: now, expectedErr: errInvalidCookie},
+		{key: key, value: "garbage", now: now, expectedErr: errInvalidCookie},
+		// Expired
+		{key: key, value: signed, now: now.Add(time.Minute), expectedErr: errCookieExpired},
+	}
+
+	for i, testCase := range testCases {
+		cookie, err := verifyCookie(testCase.key, testCase.value, testCase.now)
+		if err != testCase.expectedErr {
+			t.Errorf("[%d] - Expected error %v, got %v", i, testCase.expectedErr, err)
+			continue
+		}
+		if err == nil && (cookie.Session != "session" || cookie.State != "state" || cookie.Nonce != "nonce" || cookie.CodeVerifier != "verifier") {
+			t.Errorf("[%d] - Expected cookie to round trip, got %+v", i, cookie)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+// Limits STS puts on AssumeRole
+const (
+	stsMinSessionDuration = 15 * time.Minute
+	stsMaxSessionDuration = 12 * time.Hour
+)
+
+// resolveSessionDuration works out how long a session for the role should
+// last, and why. The user's directory duration is used if set, which the
+// client can shorten, but never lengthen. That's then capped by the role
+// and server maximums. Role maximums are never below the STS minimum, which
+// config loading makes sure of. The role's MaxSessionDuration in IAM isn't
+// known here, and STS refuses anything longer.
+func resolveSessionDuration(policy config.SessionDuration, user *directory.User, roleARN string, requested time.Duration) (time.Duration, string) {
+	duration, reason := policy.Default, handlers.DurationReasonDefault
+	if user.SessionDuration > 0 {
+		duration, reason = user.SessionDuration, handlers.DurationReasonDirectory
+	}
+
+	if requested > 0 && requested < duration {
+		duration, reason = requested, handlers.DurationReasonRequested
+	}
+
+	if roleMax, ok := policy.RoleMax[roleARN]; ok && duration > roleMax {
+		duration, reason = roleMax, handlers.DurationReasonRoleMaximum
+	}
+
+	if policy.Max > 0 && duration > policy.Max {
+		duration, reason = policy.Max, handlers.DurationReasonServerMaximum
+	}
+
+	if duration < stsMinSessionDuration {
+		duration, reason = stsMinSessionDuration, handlers.DurationReasonSTSMinimum
+	}
+
+	if duration > stsMaxSessionDuration {
+		duration, reason = stsMaxSessionDuration, handlers.DurationReasonSTSMaximum
+	}
+
+	return duration, reason
+}
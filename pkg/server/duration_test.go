@@ -0,0 +1,94 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+func TestResolveSessionDuration(t *testing.T) {
+	roleARN := "arn:aws:iam::123456789012:role/admin"
+	policy := config.SessionDuration{
+		Default: time.Hour,
+		Max:     8 * time.Hour,
+		RoleMax: map[string]time.Duration{roleARN: 2 * time.Hour},
+	}
+
+	testCases := []struct {
+		policy           config.SessionDuration
+		user             *directory.User
+		roleARN          string
+		requested        time.Duration
+		expectedDuration time.Duration
+		expectedReason   string
+	}{
+		// Nothing set on the user uses the default
+		{
+			policy:           policy,
+			user:             &directory.User{},
+			expectedDuration: time.Hour,
+			expectedReason:   handlers.DurationReasonDefault,
+		},
+		// User's directory duration wins over the default
+		{
+			policy:           policy,
+			user:             &directory.User{SessionDuration: 4 * time.Hour},
+			expectedDuration: 4 * time.Hour,
+			expectedReason:   handlers.DurationReasonDirectory,
+		},
+		// Client can ask for less
+		{
+			policy:           policy,
+			user:             &directory.User{SessionDuration: 4 * time.Hour},
+			requested:        30 * time.Minute,
+			expectedDuration: 30 * time.Minute,
+			expectedReason:   handlers.DurationReasonRequested,
+		},
+		// But not more
+		{
+			policy:           policy,
+			user:             &directory.User{SessionDuration: 4 * time.Hour},
+			requested:        6 * time.Hour,
+			expectedDuration: 4 * time.Hour,
+			expectedReason:   handlers.DurationReasonDirectory,
+		},
+		// Role maximum caps the directory duration
+		{
+			policy:           policy,
+			user:             &directory.User{SessionDuration: 4 * time.Hour},
+			roleARN:          roleARN,
+			expectedDuration: 2 * time.Hour,
+			expectedReason:   handlers.DurationReasonRoleMaximum,
+		},
+		{
+			policy:           policy,
+			user:             &directory.User{SessionDuration: 10 * time.Hour},
+			expectedDuration: 8 * time.Hour,
+			expectedReason:   handlers.DurationReasonServerMaximum,
+		},
+		{
+			policy:           policy,
+			user:             &directory.User{},
+			requested:        time.Minute,
+			expectedDuration: 15 * time.Minute,
+			expectedReason:   handlers.DurationReasonSTSMinimum,
+		},
+		{
+			policy:           config.SessionDuration{Default: time.Hour},
+			user:             &directory.User{SessionDuration: 24 * time.Hour},
+			expectedDuration: 12 * time.Hour,
+			expectedReason:   handlers.DurationReasonSTSMaximum,
+		},
+	}
+
+	for i, testCase := range testCases {
+		duration, reason := resolveSessionDuration(testCase.policy, testCase.user, testCase.roleARN, testCase.requested)
+		if duration != testCase.expectedDuration || reason != testCase.expectedReason {
+			t.Errorf("[%d] - Expected %s (%s), got %s (%s)\n", i,
+				testCase.expectedDuration, testCase.expectedReason, duration, reason)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+)
+
+// checkIdentity enforces the identity policy on a verified ID token. A nil
+// return means the identity is allowed.
+func checkIdentity(policy config.Identity, idToken *oauth.IDToken) *handlers.ErrorResponse {
+	if len(policy.AllowedHostedDomains) > 0 && !containsFold(policy.AllowedHostedDomains, idToken.Hd) {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeHostedDomainNotAllowed,
+			Message: fmt.Sprintf("hosted domain %q is not allowed", idToken.Hd),
+		}
+	}
+
+	// The authorized party is the client the token was issued to, which is only
+	// set by the provider when it differs from the audience
+	clientID := idToken.Azp
+	if clientID == "" {
+		clientID = idToken.Aud
+	}
+	if len(policy.AllowedAudiences) > 0 && !containsFold(policy.AllowedAudiences, clientID) {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeAudienceNotAllowed,
+			Message: fmt.Sprintf("client %q is not allowed", clientID),
+		}
+	}
+
+	if policy.RequireEmailVerified && !idToken.Verified {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeEmailNotVerified,
+			Message: "email address is not verified",
+		}
+	}
+
+	return nil
+}
+
+// authorizeIdentity checks the ID token against the server's identity policy,
+// writing a 403 with the violation if it doesn't pass
+func (s *Server) authorizeIdentity(w http.ResponseWriter, idToken *oauth.IDToken) bool {
+	violation := checkIdentity(s.identityPolicy, idToken)
+	if violation == nil {
+		return true
+	}
+
+	s.logger.Warn("identity rejected by policy",
+		zap.String("email", idToken.Email),
+		zap.String("hd", idToken.Hd),
+		zap.String("aud", idToken.Aud),
+		zap.String("code", violation.Code))
+	httphelper.JSONResponse(w, violation, http.StatusForbidden)
+	return false
+}
+
+// checkAccount enforces the identity policy on the state of the user's
+// directory account. A nil response means the account passes.
+func checkAccount(policy config.Identity, user *directory.User) *handlers.ErrorResponse {
+	if policy.DenySuspended && user.Suspended {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeUserSuspended,
+			Message: "account " + user.Email + " is suspended",
+		}
+	}
+
+	if policy.DenyArchived && user.Archived {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeUserArchived,
+			Message: "account " + user.Email + " is archived",
+		}
+	}
+
+	if policy.Require2SV && !user.EnrolledIn2SV {
+		return &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeUser2SVRequired,
+			Message: "account " + user.Email + " must have 2-Step Verification turned on",
+		}
+	}
+
+	return nil
+}
+
+// authorizeAccount checks the user's account against the server's identity
+// policy, writing a 403 with the violation if it doesn't pass
+func (s *Server) authorizeAccount(w http.ResponseWriter, user *directory.User) bool {
+	violation := checkAccount(s.identityPolicy, user)
+	if violation == nil {
+		return true
+	}
+
+	s.logger.Warn("account rejected by policy",
+		zap.String("email", user.Email),
+		zap.String("code", violation.Code))
+	httphelper.JSONResponse(w, violation, http.StatusForbidden)
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
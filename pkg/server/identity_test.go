@@ -0,0 +1,123 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+func TestCheckIdentity(t *testing.T) {
+	policy := config.Identity{
+		AllowedHostedDomains: []string{"example.com"},
+		AllowedAudiences:     []string{"cli-client"},
+		RequireEmailVerified: true,
+	}
+
+	testCases := []struct {
+		policy       config.Identity
+		idToken      *oauth.IDToken
+		expectedCode string
+	}{
+		// Identity meeting the whole policy is allowed
+		{
+			policy:  policy,
+			idToken: &oauth.IDToken{Hd: "example.com", Aud: "cli-client", Verified: true},
+		},
+		// Domains are compared case insensitively
+		{
+			policy:  policy,
+			idToken: &oauth.IDToken{Hd: "Example.com", Aud: "cli-client", Verified: true},
+		},
+		// Consumer accounts have no hosted domain
+		{
+			policy:       policy,
+			idToken:      &oauth.IDToken{Aud: "cli-client", Verified: true},
+			expectedCode: handlers.ErrorCodeHostedDomainNotAllowed,
+		},
+		// The authorized party takes precedence over the audience
+		{
+			policy:       policy,
+			idToken:      &oauth.IDToken{Hd: "example.com", Aud: "cli-client", Azp: "other-client", Verified: true},
+			expectedCode: handlers.ErrorCodeAudienceNotAllowed,
+		},
+		{
+			policy:       policy,
+			idToken:      &oauth.IDToken{Hd: "example.com", Aud: "cli-client"},
+			expectedCode: handlers.ErrorCodeEmailNotVerified,
+		},
+		// An empty policy allows anything
+		{
+			policy:  config.Identity{},
+			idToken: &oauth.IDToken{},
+		},
+	}
+
+	for i, testCase := range testCases {
+		violation := checkIdentity(testCase.policy, testCase.idToken)
+
+		code := ""
+		if violation != nil {
+			code = violation.Code
+		}
+
+		if code != testCase.expectedCode {
+			t.Errorf("[%d] - Expected code %q, got %q\n", i, testCase.expectedCode, code)
+		}
+	}
+}
+
+func TestCheckAccount(t *testing.T) {
+	policy := config.Identity{
+		DenySuspended: true,
+		DenyArchived:  true,
+		Require2SV:    true,
+	}
+
+	testCases := []struct {
+		policy       config.Identity
+		user         *directory.User
+		expectedCode string
+	}{
+		{
+			policy: policy,
+			user:   &directory.User{EnrolledIn2SV: true},
+		},
+		{
+			policy:       policy,
+			user:         &directory.User{Suspended: true, EnrolledIn2SV: true},
+			expectedCode: handlers.ErrorCodeUserSuspended,
+		},
+		{
+			policy:       policy,
+			user:         &directory.User{Archived: true, EnrolledIn2SV: true},
+			expectedCode: handlers.ErrorCodeUserArchived,
+		},
+		// Enforced by the domain isn't the same as turned on
+		{
+			policy:       policy,
+			user:         &directory.User{EnforcedIn2SV: true},
+			expectedCode: handlers.ErrorCodeUser2SVRequired,
+		},
+		// An empty policy allows anything
+		{
+			policy: config.Identity{},
+			user:   &directory.User{Suspended: true, Archived: true},
+		},
+	}
+
+	for i, testCase := range testCases {
+		violation := checkAccount(testCase.policy, testCase.user)
+
+		code := ""
+		if violation != nil {
+			code = violation.Code
+		}
+
+		if code != testCase.expectedCode {
+			t.Errorf("[%d] - Expected code %q, got %q\n", i, testCase.expectedCode, code)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	ini "gopkg.in/ini.v1"
+)
+
+const (
+	legacyProfileSectionName = "default"
+)
+
+// legacyCredentialFile renders the credentials the way clients that predate
+// the versioned response expect them: a credentials file with a single
+// [default] profile
+func legacyCredentialFile(creds *handlers.Credentials) ([]byte, error) {
+	credFile := ini.Empty()
+
+	section, err := credFile.NewSection(legacyProfileSectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	section.NewKey("aws_access_key_id", creds.AccessKeyID)
+	section.NewKey("aws_secret_access_key", creds.SecretAccessKey)
+	section.NewKey("aws_session_token", creds.SessionToken)
+	section.NewKey("region", creds.Region)
+
+	var b bytes.Buffer
+	if _, err := credFile.WriteTo(&b); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
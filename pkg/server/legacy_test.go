@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestLegacyCredentialFile(t *testing.T) {
+	raw, err := legacyCredentialFile(&handlers.Credentials{
+		AccessKeyID:     "AKIA",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Region:          "us-west-2",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, err := ini.Load(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error loading rendered file: %v", err)
+	}
+
+	section, err := f.GetSection("default")
+	if err != nil {
+		t.Fatalf("Expected a [default] profile, got %s", raw)
+	}
+
+	expected := map[string]string{
+		"aws_access_key_id":     "AKIA",
+		"aws_secret_access_key": "secret",
+		"aws_session_token":     "token",
+		"region":                "us-west-2",
+	}
+	for name, value := range expected {
+		if got := section.Key(name).String(); got != value {
+			t.Errorf("Expected %s to be %q, got %q", name, value, got)
+		}
+	}
+}
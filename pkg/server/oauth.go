@@ -1,33 +1,355 @@
 package server
 
 import (
-	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
 	"net/http"
+	"time"
 
 	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
-// TODO: These are routes great for debugging, not for logging in
+const (
+	// How long a pickup waits on the login to finish before telling the
+	// client to try again. Kept under the server's write timeout.
+	pickupWait = 10 * time.Second
+)
+
+// SessionHandler starts a browser login for the client. The body is the same
+// CredentialHandlerRequest the credential handler takes, minus the caller's
+// identity, which comes from the browser login instead.
+func (s *Server) SessionHandler(w http.ResponseWriter, req *http.Request) {
+	request := &handlers.CredentialHandlerRequest{}
+
+	body, err := ioutil.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		s.logger.Error("error reading session request", zap.Error(err))
+		httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
+		return
+	}
 
-// LoginHandler redirects a client to the Google OAuth login page
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, request); err != nil {
+			s.logger.Error("error unmarshalling session request", zap.Error(err))
+			httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
+			return
+		}
+	}
+	// Nothing to identify the caller is taken from here
+	request.CredentialFile = nil
+
+	if !s.sessionLimiter.allow(remoteHost(req)) {
+		s.logger.Warn("login sessions started too fast", zap.String("remote", req.RemoteAddr))
+		httphelper.JSONResponse(w, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeTooManySessions,
+			Message: "too many logins started, try again in a minute",
+		}, http.StatusTooManyRequests)
+		return
+	}
+
+	sess, err := s.sessions.create(request)
+	switch err {
+	case nil:
+	case errTooManySessions:
+		s.logger.Warn("too many pending login sessions")
+		httphelper.JSONResponse(w, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeTooManySessions,
+			Message: "too many logins in progress, try again in a minute",
+		}, http.StatusTooManyRequests)
+		return
+	default:
+		s.logger.Error("error creating login session", zap.Error(err))
+		httphelper.JSONResponse(w, struct{}{}, http.StatusInternalServerError)
+		return
+	}
+
+	httphelper.JSONResponse(w, &handlers.SessionResponse{
+		ID:        sess.id,
+		Secret:    sess.secret,
+		UserCode:  sess.userCode,
+		ExpiresAt: sess.expires,
+	}, http.StatusCreated)
+}
+
+// LoginHandler asks the user to enter the code their terminal is showing for
+// a login session the client started. Nothing happens until they do, so a
+// login link can't be passed to someone else to log in with.
+// https://tools.ietf.org/html/rfc8628#section-5.4
 func (s *Server) LoginHandler(w http.ResponseWriter, req *http.Request) {
-	http.Redirect(w, req, s.oAuthSvc.GetOAuthLoginURL(), http.StatusFound)
+	id := req.URL.Query().Get("session")
+
+	sess, err := s.sessions.get(id)
+	if err != nil {
+		s.logger.Warn("browser login without a usable session", zap.Error(err))
+		loginPage(w, http.StatusBadRequest, "This login link is invalid or has expired. Run the login again from your terminal.")
+		return
+	}
+
+	// Ties the form to this browser, so another site can't post it
+	token, err := oauth.RandomString()
+	if err != nil {
+		s.logger.Error("error generating confirm token", zap.Error(err))
+		loginPage(w, http.StatusInternalServerError, "Something went wrong starting the login. Try again.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     confirmCookieName,
+		Value:    token,
+		Path:     "/auth/login",
+		Expires:  sess.expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+	})
+	confirmPage(w, http.StatusOK, sess, token, "")
+}
+
+// ConfirmLoginHandler checks the code the user entered and, if it's the one
+// their terminal showed, redirects the browser to the Google OAuth login
+// page. The login's state, nonce and PKCE verifier ride along in a signed
+// cookie for the callback to check.
+func (s *Server) ConfirmLoginHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		loginPage(w, http.StatusBadRequest, "This login link is invalid or has expired. Run the login again from your terminal.")
+		return
+	}
+
+	cookie, err := req.Cookie(confirmCookieName)
+	token := req.PostFormValue("token")
+	if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		s.logger.Warn("login confirmation without a matching token", zap.String("remote", req.RemoteAddr))
+		loginPage(w, http.StatusBadRequest, "This login didn't come from this browser. Run the login again from your terminal.")
+		return
+	}
+
+	id := req.PostFormValue("session")
+	sess, err := s.sessions.confirm(id, req.PostFormValue("user_code"))
+	switch err {
+	case nil:
+	case errWrongUserCode:
+		pending, err := s.sessions.get(id)
+		if err != nil {
+			loginPage(w, http.StatusBadRequest, "This login link is invalid or has expired. Run the login again from your terminal.")
+			return
+		}
+		confirmPage(w, http.StatusBadRequest, pending, token, "That code doesn't match the one in your terminal.")
+		return
+	default:
+		s.logger.Warn("login confirmation without a usable session", zap.Error(err))
+		loginPage(w, http.StatusBadRequest, "This login link is invalid or has expired. Run the login again from your terminal.")
+		return
+	}
+
+	state, err := s.oAuthSvc.NewLoginState()
+	if err != nil {
+		s.logger.Error("error generating login state", zap.Error(err))
+		loginPage(w, http.StatusInternalServerError, "Something went wrong starting the login. Try again.")
+		return
+	}
+
+	expires := time.Now().Add(loginCookieTTL)
+	if sess.expires.Before(expires) {
+		expires = sess.expires
+	}
+
+	value, err := signCookie(s.cookieKey, &loginCookie{
+		Session:      sess.id,
+		State:        state.State,
+		Nonce:        state.Nonce,
+		CodeVerifier: state.CodeVerifier,
+		Expires:      expires.Unix(),
+	})
+	if err != nil {
+		s.logger.Error("error signing login cookie", zap.Error(err))
+		loginPage(w, http.StatusInternalServerError, "Something went wrong starting the login. Try again.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   confirmCookieName,
+		Path:   "/auth/login",
+		MaxAge: -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookieName,
+		Value:    value,
+		Path:     "/auth",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+	})
+	http.Redirect(w, req, s.oAuthSvc.GetOAuthLoginURL(state), http.StatusSeeOther)
 }
 
-// CallbackHandler handles the OAuth callback
+// CallbackHandler handles the OAuth callback, issuing credentials for the
+// login session the browser started with. Callbacks that don't carry the
+// state the browser was sent off with are rejected without touching the
+// session, so they can't be forged into someone else's login.
 // https://developers.google.com/identity/protocols/OAuth2WebServer
 func (s *Server) CallbackHandler(w http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
+	cookie, err := req.Cookie(loginCookieName)
+	if err != nil {
+		loginPage(w, http.StatusBadRequest, "No login in progress. Run the login again from your terminal.")
+		return
+	}
 
-	idToken, err := s.oAuthSvc.Exchange(context.Background(), vars["code"])
+	login, err := verifyCookie(s.cookieKey, cookie.Value, time.Now())
+	if err != nil {
+		s.logger.Warn("OAuth callback with a bad login cookie", zap.Error(err))
+		loginPage(w, http.StatusBadRequest, "This login has expired. Run the login again from your terminal.")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.URL.Query().Get("state")), []byte(login.State)) != 1 {
+		s.logger.Warn("OAuth callback state does not match", zap.String("remote", req.RemoteAddr))
+		loginPage(w, http.StatusBadRequest, "This login didn't come from this browser. Run the login again from your terminal.")
+		return
+	}
+
+	// The session is done with whatever happens from here
+	http.SetCookie(w, &http.Cookie{
+		Name:   loginCookieName,
+		Path:   "/auth",
+		MaxAge: -1,
+	})
+
+	sess, err := s.sessions.begin(login.Session)
+	if err != nil {
+		s.logger.Warn("OAuth callback without a usable session", zap.Error(err))
+		loginPage(w, http.StatusBadRequest, "This login has expired or was already used. Run the login again from your terminal.")
+		return
+	}
+
+	response, errResp, status := s.completeLogin(req, sess.request, &oauth.LoginState{
+		State:        login.State,
+		Nonce:        login.Nonce,
+		CodeVerifier: login.CodeVerifier,
+	})
+	s.sessions.complete(sess, response, errResp, status)
+
+	if errResp != nil {
+		loginPage(w, status, "Login failed: "+errResp.Message)
+		return
+	}
+
+	loginPage(w, http.StatusOK, "You're logged in. You can close this window and go back to your terminal.")
+}
+
+// completeLogin exchanges the callback's code for the user's identity and
+// issues the credentials the session asked for
+func (s *Server) completeLogin(req *http.Request, request *handlers.CredentialHandlerRequest, state *oauth.LoginState) (*handlers.CredentialHandlerResponse, *handlers.ErrorResponse, int) {
+	query := req.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		return nil, &handlers.ErrorResponse{Message: "login was not completed: " + reason}, http.StatusUnauthorized
+	}
+
+	idToken, err := s.oAuthSvc.Exchange(req.Context(), query.Get("code"), state)
 	if err != nil {
 		s.logger.Error("error exchanging OAuth code", zap.Error(err))
-		httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
+		return nil, &handlers.ErrorResponse{Message: "error exchanging OAuth code"}, http.StatusUnauthorized
+	}
+
+	if violation := checkIdentity(s.identityPolicy, idToken); violation != nil {
+		s.logger.Warn("identity rejected by policy",
+			zap.String("email", idToken.Email),
+			zap.String("hd", idToken.Hd),
+			zap.String("aud", idToken.Aud),
+			zap.String("code", violation.Code))
+		return nil, violation, http.StatusForbidden
+	}
+
+	user, err := s.directorySvc.GetUser(idToken.Email)
+	if err != nil {
+		s.logger.Error("error getting user", zap.String("email", idToken.Email), zap.Error(err))
+		return nil, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeUserNotFound,
+			Message: "user " + idToken.Email + " was not found in the directory",
+		}, http.StatusForbidden
+	}
+
+	if violation := checkAccount(s.identityPolicy, user); violation != nil {
+		s.logger.Warn("account rejected by policy",
+			zap.String("email", user.Email),
+			zap.String("code", violation.Code))
+		return nil, violation, http.StatusForbidden
+	}
+
+	return s.issueCredentials(user, request)
+}
+
+// PickupHandler hands the credentials from a finished browser login to the
+// client that started it. Until the login finishes, it answers with a 202
+// for the client to try again.
+func (s *Server) PickupHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	sess, err := s.sessions.pickup(id, bearerToken(req), pickupWait, req.Context().Done())
+	switch err {
+	case nil:
+	case errSessionExpired:
+		httphelper.JSONResponse(w, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeSessionExpired,
+			Message: "login session expired",
+		}, http.StatusGone)
+		return
+	default:
+		httphelper.JSONResponse(w, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeSessionNotFound,
+			Message: "login session not found",
+		}, http.StatusNotFound)
 		return
 	}
 
-	// TODO: This is not how this should work
-	httphelper.JSONResponse(w, idToken, http.StatusOK)
+	if sess == nil {
+		httphelper.JSONResponse(w, struct{}{}, http.StatusAccepted)
+		return
+	}
+
+	if sess.errResp != nil {
+		httphelper.JSONResponse(w, sess.errResp, sess.status)
+		return
+	}
+
+	httphelper.JSONResponse(w, sess.response, http.StatusOK)
+}
+
+// loginPage tells the user in the browser how the login went
+func loginPage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>GSuite AWS SSO</title></head><body><p>%s</p></body></html>", html.EscapeString(message))
+}
+
+// confirmPage asks the user for the code their terminal is showing
+func confirmPage(w http.ResponseWriter, status int, sess *loginSession, token, message string) {
+	role := sess.request.Role
+	if role == "" {
+		role = "your default role"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html><html><head><title>GSuite AWS SSO</title></head><body>
+<p>%s</p>
+<p>A login for %s was started from a terminal. Only continue if you started it yourself: enter the code your terminal is showing.</p>
+<form method="post" action="/auth/login">
+<input type="hidden" name="session" value="%s">
+<input type="hidden" name="token" value="%s">
+<input type="text" name="user_code" placeholder="BCDF-GHJK" autocomplete="off" autofocus>
+<button type="submit">Continue</button>
+</form>
+</body></html>`,
+		html.EscapeString(message),
+		html.EscapeString(role),
+		html.EscapeString(sess.id),
+		html.EscapeString(token))
 }
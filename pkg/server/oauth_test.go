@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"go.uber.org/zap"
+)
+
+// fakeLoginOAuth hands out a fixed login state, and only exchanges the code
+// with the verifier that goes with it
+type fakeLoginOAuth struct {
+	oauth.Service
+	exchanged bool
+}
+
+func (f *fakeLoginOAuth) NewLoginState() (*oauth.LoginState, error) {
+	return &oauth.LoginState{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}, nil
+}
+
+func (f *fakeLoginOAuth) GetOAuthLoginURL(state *oauth.LoginState) string {
+	return "https://provider/auth?state=" + state.State
+}
+
+func (f *fakeLoginOAuth) Exchange(ctx context.Context, code string, state *oauth.LoginState) (*oauth.IDToken, error) {
+	f.exchanged = true
+	if code != "code" || state.CodeVerifier != "verifier" || state.Nonce != "nonce" {
+		return nil, errors.New("bad exchange")
+	}
+	return &oauth.IDToken{Email: "user@example.com"}, nil
+}
+
+// missingDirectory doesn't know anyone
+type missingDirectory struct{}
+
+func (missingDirectory) GetUser(email string) (*directory.User, error) {
+	return nil, errors.New("user not found")
+}
+
+// confirmLogin opens the session's login page and posts the code back with
+// the page's cookie and token, like a browser would
+func confirmLogin(s *Server, id, userCode string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.LoginHandler(w, httptest.NewRequest("GET", "/auth/login?session="+id, nil))
+
+	cookies := w.Result().Cookies()
+	form := url.Values{"session": {id}, "user_code": {userCode}}
+	for _, cookie := range cookies {
+		form.Set("token", cookie.Value)
+	}
+
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	w = httptest.NewRecorder()
+	s.ConfirmLoginHandler(w, req)
+	return w
+}
+
+func TestConfirmLoginHandler(t *testing.T) {
+	s := &Server{
+		logger:    zap.NewNop(),
+		oAuthSvc:  &fakeLoginOAuth{},
+		sessions:  newSessionStore(time.Minute),
+		cookieKey: []byte("key"),
+	}
+
+	sess, _ := s.sessions.create(&handlers.CredentialHandlerRequest{})
+
+	// The confirmation has to be posted from the page that showed it
+	form := url.Values{"session": {sess.id}, "user_code": {sess.userCode}, "token": {"forged"}}
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: confirmCookieName, Value: "token"})
+	w := httptest.NewRecorder()
+	s.ConfirmLoginHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a forged token, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := confirmLogin(s, sess.id, "BBBB-BBBB"); w.Code != http.StatusBadRequest || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected the wrong code to be refused, got %d", w.Code)
+	}
+
+	// The code can be typed without the dash, in any case
+	w = confirmLogin(s, sess.id, strings.ToLower(strings.Replace(sess.userCode, "-", "", 1)))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect to log in, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://provider/auth?state=state" {
+		t.Errorf("Expected redirect to the provider, got %q", location)
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	testCases := []struct {
+		state           string
+		expectedStatus  int
+		expectExchange  bool
+		expectCompleted bool
+	}{
+		// The login goes through to the directory, which doesn't know the user
+		{state: "state", expectedStatus: http.StatusForbidden, expectExchange: true, expectCompleted: true},
+		// Forged callbacks are turned away without touching the session
+		{state: "forged", expectedStatus: http.StatusBadRequest},
+		{state: "", expectedStatus: http.StatusBadRequest},
+	}
+
+	for i, testCase := range testCases {
+		oAuthSvc := &fakeLoginOAuth{}
+		s := &Server{
+			logger:       zap.NewNop(),
+			oAuthSvc:     oAuthSvc,
+			directorySvc: missingDirectory{},
+			sessions:     newSessionStore(time.Minute),
+			cookieKey:    []byte("key"),
+		}
+
+		sess, _ := s.sessions.create(&handlers.CredentialHandlerRequest{})
+
+		w := confirmLogin(s, sess.id, sess.userCode)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("[%d] - Expected redirect to log in, got %d", i, w.Code)
+		}
+
+		req := httptest.NewRequest("GET", "/auth/callback?code=code&state="+testCase.state, nil)
+		for _, cookie := range w.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		s.CallbackHandler(w, req)
+
+		if w.Code != testCase.expectedStatus {
+			t.Errorf("[%d] - Expected status %d, got %d", i, testCase.expectedStatus, w.Code)
+		}
+		if oAuthSvc.exchanged != testCase.expectExchange {
+			t.Errorf("[%d] - Expected exchange %v, got %v", i, testCase.expectExchange, oAuthSvc.exchanged)
+		}
+
+		select {
+		case <-sess.done:
+			if !testCase.expectCompleted {
+				t.Errorf("[%d] - Expected session to still be pending", i)
+			}
+			if sess.errResp == nil || sess.errResp.Code != handlers.ErrorCodeUserNotFound {
+				t.Errorf("[%d] - Expected %s, got %+v", i, handlers.ErrorCodeUserNotFound, sess.errResp)
+			}
+		default:
+			if testCase.expectCompleted {
+				t.Errorf("[%d] - Expected session to be completed", i)
+			}
+		}
+	}
+}
+
+func TestCallbackHandlerWithoutCookie(t *testing.T) {
+	s := &Server{
+		logger:    zap.NewNop(),
+		oAuthSvc:  &fakeLoginOAuth{},
+		sessions:  newSessionStore(time.Minute),
+		cookieKey: []byte("key"),
+	}
+
+	w := httptest.NewRecorder()
+	s.CallbackHandler(w, httptest.NewRequest("GET", "/auth/callback?code=code&state=state", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
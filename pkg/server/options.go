@@ -1,9 +1,13 @@
 package server
 
 import (
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/role"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -17,6 +21,15 @@ type Options struct {
 	OAuth     oauth.Service
 	Directory directory.Service
 	Role      role.Service
+	Identity  config.Identity
+	// Decides who can assume which role
+	RolePolicy *policy.Policy
+	// Limits on how long issued credentials last
+	SessionDuration config.SessionDuration
+	// Key the browser login cookies are signed with
+	CookieKey []byte
+	// Bearer token for the admin endpoints
+	AdminToken []byte
 }
 
 // Option is a functional way of setting options for the server
@@ -64,9 +77,53 @@ func WithRole(r role.Service) Option {
 	}
 }
 
+// WithIdentityPolicy sets the policy incoming identities are checked against
+func WithIdentityPolicy(i config.Identity) Option {
+	return func(o *Options) {
+		o.Identity = i
+	}
+}
+
+// WithRolePolicy sets the policy deciding who can assume which role
+func WithRolePolicy(p *policy.Policy) Option {
+	return func(o *Options) {
+		o.RolePolicy = p
+	}
+}
+
+// WithSessionDuration sets the limits on how long issued credentials last
+func WithSessionDuration(d config.SessionDuration) Option {
+	return func(o *Options) {
+		o.SessionDuration = d
+	}
+}
+
+// WithCookieKey sets the key the browser login cookies are signed with
+func WithCookieKey(key []byte) Option {
+	return func(o *Options) {
+		o.CookieKey = key
+	}
+}
+
+// WithAdminToken sets the bearer token for the admin endpoints
+func WithAdminToken(token []byte) Option {
+	return func(o *Options) {
+		o.AdminToken = token
+	}
+}
+
 func defaultOptions() *Options {
 	return &Options{
 		Logger: logging.Logger(),
 		Port:   3030,
+		Identity: config.Identity{
+			RequireEmailVerified: true,
+			AllowCredentialFile:  true,
+			DenySuspended:        true,
+			DenyArchived:         true,
+		},
+		SessionDuration: config.SessionDuration{
+			Default: time.Hour,
+		},
 	}
 }
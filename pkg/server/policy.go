@@ -0,0 +1,39 @@
+package server
+
+import (
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+// checkRole evaluates the role policy for the user assuming the role. A nil
+// response means they're allowed, as is everyone when there's no policy.
+func checkRole(p *policy.Policy, user *directory.User, roleARN string, now time.Time) (*handlers.ErrorResponse, *policy.Decision) {
+	if p == nil {
+		return nil, nil
+	}
+
+	decision := p.Evaluate(&policy.Request{User: user, RoleARN: roleARN, Time: now})
+	if decision.Allowed {
+		return nil, decision
+	}
+
+	return &handlers.ErrorResponse{
+		Code:    handlers.ErrorCodeRoleDenied,
+		Message: "role " + roleARN + " " + decision.Reason,
+	}, decision
+}
+
+// allowedRoles filters out the user's roles the policy won't let them assume
+// right now
+func allowedRoles(p *policy.Policy, user *directory.User, now time.Time) []directory.Role {
+	roles := []directory.Role{}
+	for _, role := range user.Roles {
+		if errResp, _ := checkRole(p, user, role.ARN, now); errResp == nil {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
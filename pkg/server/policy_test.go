@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+func TestCheckRole(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: no-prod
+    effect: deny
+    roles: ["arn:aws:iam::222222222222:role/*"]
+  - name: everyone
+    effect: allow
+`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	dev := directory.Role{ARN: "arn:aws:iam::111111111111:role/admin", ProviderARN: "arn:aws:iam::111111111111:saml-provider/GSuite"}
+	prod := directory.Role{ARN: "arn:aws:iam::222222222222:role/admin", ProviderARN: "arn:aws:iam::222222222222:saml-provider/GSuite"}
+	user := &directory.User{Email: "alice@example.com", Roles: []directory.Role{dev, prod}}
+
+	testCases := []struct {
+		policy       *policy.Policy
+		role         string
+		expectedCode string
+	}{
+		// Without a policy, entitlement is enough
+		{role: prod.ARN},
+		{policy: p, role: dev.ARN},
+		{policy: p, role: prod.ARN, expectedCode: handlers.ErrorCodeRoleDenied},
+	}
+
+	for i, tc := range testCases {
+		errResp, _ := checkRole(tc.policy, user, tc.role, time.Now())
+		code := ""
+		if errResp != nil {
+			code = errResp.Code
+		}
+		if code != tc.expectedCode {
+			t.Errorf("[%d] - Expected code %q, got %q", i, tc.expectedCode, code)
+		}
+	}
+
+	roles := allowedRoles(p, user, time.Now())
+	if len(roles) != 1 || roles[0] != dev {
+		t.Errorf("Expected only %v to be allowed, got %v", dev, roles)
+	}
+}
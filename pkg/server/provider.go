@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+
+	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+// ProviderHandler tells clients how to log into the identity provider on
+// their own, e.g. with the device flow
+func (s *Server) ProviderHandler(w http.ResponseWriter, req *http.Request) {
+	provider := s.oAuthSvc.Provider()
+
+	httphelper.JSONResponse(w, &handlers.ProviderResponse{
+		AuthURL:       provider.AuthURL,
+		TokenURL:      provider.TokenURL,
+		DeviceAuthURL: provider.DeviceAuthURL,
+		ClientID:      provider.ClientID,
+		ClientSecret:  provider.ClientSecret,
+		Scopes:        provider.Scopes,
+	}, http.StatusOK)
+}
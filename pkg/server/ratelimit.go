@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// How many login sessions one address can start in a window
+	sessionRateLimit  = 10
+	sessionRateWindow = time.Minute
+)
+
+// rateLimiter allows each key a number of requests per fixed window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastPrune time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		windows: map[string]*rateWindow{},
+	}
+}
+
+// allow counts a request for the key, reporting whether it's within the limit
+func (rl *rateLimiter) allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.prune(now)
+
+	w, ok := rl.windows[key]
+	if !ok || now.Sub(w.start) >= rl.window {
+		w = &rateWindow{start: now}
+		rl.windows[key] = w
+	}
+
+	if w.count >= rl.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// prune drops windows that have ended, at most once a window. Must be called
+// with the lock held.
+func (rl *rateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < rl.window {
+		return
+	}
+	rl.lastPrune = now
+
+	for key, w := range rl.windows {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.windows, key)
+		}
+	}
+}
+
+// remoteHost is the address the request came from, without the port
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := newRateLimiter(2, time.Minute)
+	rl.now = func() time.Time { return now }
+
+	testCases := []struct {
+		key      string
+		advance  time.Duration
+		expected bool
+	}{
+		{key: "a", expected: true},
+		{key: "a", expected: true},
+		{key: "a", expected: false},
+		// Other keys have their own limit
+		{key: "b", expected: true},
+		{key: "a", advance: 59 * time.Second, expected: false},
+		// A new window starts once the last one ends
+		{key: "a", advance: time.Second, expected: true},
+	}
+
+	for i, tc := range testCases {
+		now = now.Add(tc.advance)
+		if allowed := rl.allow(tc.key); allowed != tc.expected {
+			t.Errorf("[%d] - Expected allowed to be %t, got %t", i, tc.expected, allowed)
+		}
+	}
+
+	if _, ok := rl.windows["b"]; ok {
+		t.Errorf("Expected the ended window to be pruned")
+	}
+}
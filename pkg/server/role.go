@@ -1,12 +1,14 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
 	httphelper "github.com/catherinetcai/gsuite-aws-sso/pkg/http"
+	rolesvc "github.com/catherinetcai/gsuite-aws-sso/pkg/role"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
 	"go.uber.org/zap"
 )
@@ -15,58 +17,188 @@ import (
 
 // CredentialHandler takes in a client access token, validates it, and then returns a set of credentials
 func (s *Server) CredentialHandler(w http.ResponseWriter, req *http.Request) {
-	request := &handlers.CredentialHandlerRequest{}
+	request, user, ok := s.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	response, errResp, status := s.issueCredentials(user, request)
+	if errResp != nil {
+		httphelper.JSONResponse(w, errResp, status)
+		return
+	}
+
+	httphelper.JSONResponse(w, response, http.StatusOK)
+}
+
+// issueCredentials assumes the role the user asked for. If that fails, the
+// error response and status say why.
+func (s *Server) issueCredentials(user *directory.User, request *handlers.CredentialHandlerRequest) (*handlers.CredentialHandlerResponse, *handlers.ErrorResponse, int) {
 	response := &handlers.CredentialHandlerResponse{}
 
+	role, errResp := selectRole(user, request.Role)
+	if errResp != nil {
+		s.logger.Warn("error selecting role",
+			zap.String("email", user.Email),
+			zap.String("role", request.Role),
+			zap.String("code", errResp.Code))
+		status := http.StatusBadRequest
+		if errResp.Code == handlers.ErrorCodeRoleNotEntitled {
+			status = http.StatusForbidden
+		}
+		return nil, errResp, status
+	}
+
+	if errResp, decision := checkRole(s.rolePolicy, user, role.ARN, time.Now()); errResp != nil {
+		s.logger.Warn("role denied by policy",
+			zap.String("email", user.Email),
+			zap.String("role", role.ARN),
+			zap.String("reason", decision.Reason))
+		return nil, errResp, http.StatusForbidden
+	}
+
+	requested := time.Duration(request.DurationSeconds) * time.Second
+	duration, reason := resolveSessionDuration(s.sessionDuration, user, role.ARN, requested)
+
+	// Token is valid, therefore go and try to get the role
+	cred, err := s.roleSvc.GetCredential(&rolesvc.Request{
+		RoleARN:    role.ARN,
+		Duration:   duration,
+		Email:      user.Email,
+		Attributes: user.Attributes,
+	})
+	if err != nil {
+		// TODO: We need to do better AWS error handling
+		s.logger.Error("error getting credential for email",
+			zap.String("email", user.Email),
+			zap.String("role", role.ARN),
+			zap.Error(err))
+		return nil, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeAssumeRoleFailed,
+			Message: "error assuming role " + role.ARN,
+		}, http.StatusBadRequest
+	}
+
+	response.DurationSeconds = int64(duration / time.Second)
+	response.DurationReason = reason
+	response.Credentials = &handlers.Credentials{
+		AccessKeyID:     cred.AccessKeyID,
+		SecretAccessKey: cred.SecretAccessKey,
+		SessionToken:    cred.SessionToken,
+		Expiration:      cred.Expiration,
+		Region:          cred.Region,
+		RoleARN:         cred.RoleARN,
+		AccountID:       cred.AccountID,
+	}
+
+	if request.Version == 0 {
+		// Older clients only know how to read the rendered credentials file
+		response.CredentialFile, err = legacyCredentialFile(response.Credentials)
+		if err != nil {
+			s.logger.Error("error rendering legacy credential file", zap.Error(err))
+			return nil, &handlers.ErrorResponse{Message: "error rendering credential file"}, http.StatusInternalServerError
+		}
+	} else {
+		response.Version = handlers.CredentialResponseVersion
+	}
+
+	return response, nil, http.StatusOK
+}
+
+// RolesHandler returns the roles the user is entitled to, so that the client
+// can pick one before asking for credentials
+func (s *Server) RolesHandler(w http.ResponseWriter, req *http.Request) {
+	response := &handlers.RolesHandlerResponse{Roles: []handlers.Role{}}
+
+	_, user, ok := s.authenticate(w, req)
+	if !ok {
+		return
+	}
+
+	// Only offer the roles the policy would let them assume
+	for _, role := range allowedRoles(s.rolePolicy, user, time.Now()) {
+		response.Roles = append(response.Roles, handlers.Role{
+			ARN:         role.ARN,
+			Alias:       role.Name(),
+			ProviderARN: role.ProviderARN,
+		})
+	}
+
+	httphelper.JSONResponse(w, response, http.StatusOK)
+}
+
+// authenticate reads the credential request, verifies the caller's identity
+// and looks them up in the directory. If anything fails, the error response
+// has already been written.
+func (s *Server) authenticate(w http.ResponseWriter, req *http.Request) (*handlers.CredentialHandlerRequest, *directory.User, bool) {
+	request := &handlers.CredentialHandlerRequest{}
+
 	body, err := ioutil.ReadAll(req.Body)
 	defer req.Body.Close()
 	if err != nil {
 		s.logger.Error("error reading credential request", zap.Error(err))
 		httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 
 	if err := json.Unmarshal(body, request); err != nil {
 		s.logger.Error("error unmarshalling response", zap.Error(err))
 		httphelper.JSONResponse(w, struct{}{}, http.StatusInternalServerError)
-		return
+		return nil, nil, false
 	}
 
-	tokenSource, err := s.oAuthSvc.TokenSourceFromCredentials(context.Background(), request.CredentialFile)
+	idToken, err := s.verifyCaller(req, request)
 	if err != nil {
-		s.logger.Error("error getting token source from credentials", zap.Error(err))
+		s.logger.Error("error verifying caller", zap.Error(err))
 		httphelper.JSONResponse(w, struct{}{}, http.StatusUnauthorized)
-		return
+		return nil, nil, false
 	}
 
-	idToken, err := s.oAuthSvc.IDToken(tokenSource)
-	if err != nil {
-		s.logger.Error("error getting id token", zap.Error(err))
-		httphelper.JSONResponse(w, struct{}{}, http.StatusUnauthorized)
-		return
+	if !s.authorizeIdentity(w, idToken) {
+		return nil, nil, false
 	}
 
 	user, err := s.directorySvc.GetUser(idToken.Email)
 	if err != nil {
 		httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 
 	s.logger.Info("Got user", zap.Any("user", user))
 
-	// Token is valid, therefore go and try to get the role
-	cred, err := s.roleSvc.GetCredential(user.CredentialID)
-	if err != nil {
-		// TODO: We need to do better AWS error handling
-		s.logger.Error("error getting credential for email",
-			zap.String("email", idToken.Email),
-			zap.Error(err))
-		httphelper.JSONResponse(w, struct{}{}, http.StatusBadRequest)
-		return
+	if !s.authorizeAccount(w, user) {
+		return nil, nil, false
 	}
 
-	response.CredentialFile = cred.Raw
-	response.CredentialFilePath = cred.Location
+	return request, user, true
+}
 
-	httphelper.JSONResponse(w, response, http.StatusOK)
+// selectRole picks the role the user asked for, or their only role if they
+// didn't ask for one
+func selectRole(user *directory.User, requested string) (*directory.Role, *handlers.ErrorResponse) {
+	if requested == "" {
+		if len(user.Roles) != 1 {
+			return nil, &handlers.ErrorResponse{
+				Code:    handlers.ErrorCodeRoleRequired,
+				Message: "user has more than one role, a role must be requested",
+			}
+		}
+		return &user.Roles[0], nil
+	}
+
+	role, err := user.FindRole(requested)
+	switch err {
+	case nil:
+		return role, nil
+	case directory.ErrRoleAmbiguous:
+		return nil, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeRoleAmbiguous,
+			Message: "role alias matches more than one role, request it by ARN",
+		}
+	default:
+		return nil, &handlers.ErrorResponse{
+			Code:    handlers.ErrorCodeRoleNotEntitled,
+			Message: "user is not entitled to role " + requested,
+		}
+	}
 }
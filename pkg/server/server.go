@@ -1,12 +1,15 @@
 package server
 
 import (
+	"crypto/rand"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/config"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/policy"
 	"github.com/catherinetcai/gsuite-aws-sso/pkg/role"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -21,6 +24,21 @@ type Server struct {
 	oAuthSvc     oauth.Service
 	directorySvc directory.Service
 	roleSvc      role.Service
+	// Policy identities must meet before being allowed in
+	identityPolicy config.Identity
+	// Decides who can assume which role. Nil lets everyone assume the roles
+	// they're entitled to.
+	rolePolicy *policy.Policy
+	// Limits on how long issued credentials last
+	sessionDuration config.SessionDuration
+	// Browser logins waiting on the user
+	sessions *sessionStore
+	// Limits how fast each address can start login sessions
+	sessionLimiter *rateLimiter
+	// Signs the cookies that carry a browser login's state
+	cookieKey []byte
+	// Bearer token for the admin endpoints. Empty turns them off.
+	adminToken []byte
 }
 
 // New returns a new instance of the server
@@ -34,13 +52,31 @@ func New(setOpts ...Option) (*Server, error) {
 		return nil, fmt.Errorf("error: router cannot be nil")
 	}
 
+	cookieKey := opts.CookieKey
+	if len(cookieKey) == 0 {
+		// Logins in flight won't survive a restart, and won't work across
+		// instances, but that's fine for a single server
+		opts.Logger.Warn("no cookie secret set, generating one")
+		cookieKey = make([]byte, 32)
+		if _, err := rand.Read(cookieKey); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Server{
-		router:       opts.Router,
-		logger:       opts.Logger,
-		port:         opts.Port,
-		oAuthSvc:     opts.OAuth,
-		directorySvc: opts.Directory,
-		roleSvc:      opts.Role,
+		router:          opts.Router,
+		logger:          opts.Logger,
+		port:            opts.Port,
+		oAuthSvc:        opts.OAuth,
+		directorySvc:    opts.Directory,
+		roleSvc:         opts.Role,
+		identityPolicy:  opts.Identity,
+		rolePolicy:      opts.RolePolicy,
+		sessionDuration: opts.SessionDuration,
+		sessions:        newSessionStore(loginSessionTTL),
+		sessionLimiter:  newRateLimiter(sessionRateLimit, sessionRateWindow),
+		cookieKey:       cookieKey,
+		adminToken:      opts.AdminToken,
 	}, nil
 }
 
@@ -83,17 +119,46 @@ func (s *Server) defaultRoutes() []*Route {
 			HandlerFunc: s.LoginHandler,
 			Method:      GET,
 		},
+		&Route{
+			Path:        "/auth/login",
+			HandlerFunc: s.ConfirmLoginHandler,
+			Method:      POST,
+		},
 		&Route{
 			Path:        "/auth/callback",
 			HandlerFunc: s.CallbackHandler,
 			Method:      GET,
-			Queries:     []string{"code", "{code}"},
+		},
+		&Route{
+			Path:        "/auth/sessions",
+			HandlerFunc: s.SessionHandler,
+			Method:      POST,
+		},
+		&Route{
+			Path:        "/auth/sessions/{id}/credentials",
+			HandlerFunc: s.PickupHandler,
+			Method:      GET,
+		},
+		&Route{
+			Path:        "/auth/provider",
+			HandlerFunc: s.ProviderHandler,
+			Method:      GET,
 		},
 		&Route{
 			Path:        "/credentials",
 			HandlerFunc: s.CredentialHandler,
 			Method:      POST,
 		},
+		&Route{
+			Path:        "/roles",
+			HandlerFunc: s.RolesHandler,
+			Method:      POST,
+		},
+		&Route{
+			Path:        "/admin/directory/users/{email}",
+			HandlerFunc: s.InvalidateUserHandler,
+			Method:      DELETE,
+		},
 		&Route{
 			Path:        "/health",
 			HandlerFunc: s.HealthHandler,
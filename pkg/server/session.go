@@ -0,0 +1,285 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/oauth"
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+)
+
+const (
+	// How long the user has to finish logging in, and the CLI to pick up the
+	// credentials after
+	loginSessionTTL = 10 * time.Minute
+	// Most sessions waiting on a login at once, so the store can't be grown
+	// without bound
+	maxPendingSessions = 1000
+	// Wrong user codes a session takes before it's thrown away
+	maxUserCodeAttempts = 5
+	// User codes are drawn from consonants, so they can't spell anything and
+	// are easy to read out and type. 20^8 codes.
+	// https://tools.ietf.org/html/rfc8628#section-6.1
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+var (
+	errSessionNotFound = errors.New("login session not found")
+	errSessionExpired  = errors.New("login session expired")
+	errSessionUsed     = errors.New("login session already used")
+	errTooManySessions = errors.New("too many pending login sessions")
+	errWrongUserCode   = errors.New("wrong user code")
+	errNotConfirmed    = errors.New("login session not confirmed")
+)
+
+// loginSession tracks a CLI login that's finished in the browser. The ID goes
+// through the browser, the secret stays with the CLI and is needed to pick
+// up the credentials. The user code is shown by the CLI and has to be
+// entered in the browser, so a login link sent to someone else can't be
+// used to log them in on the sender's behalf.
+type loginSession struct {
+	id       string
+	secret   string
+	userCode string
+	request  *handlers.CredentialHandlerRequest
+	expires  time.Time
+	// Set once the user code's been entered in the browser
+	confirmed bool
+	attempts  int
+	// Set once the callback has started with the session, so it can't be
+	// used for a second login
+	started bool
+	// Closed once the result is in
+	done chan struct{}
+
+	response *handlers.CredentialHandlerResponse
+	errResp  *handlers.ErrorResponse
+	status   int
+}
+
+// sessionStore keeps login sessions in memory. Sessions are deleted once
+// they're picked up or expire.
+type sessionStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*loginSession
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: map[string]*loginSession{},
+	}
+}
+
+// create starts a new session for the credential request
+func (st *sessionStore) create(request *handlers.CredentialHandlerRequest) (*loginSession, error) {
+	id, err := oauth.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := oauth.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &loginSession{
+		id:       id,
+		secret:   secret,
+		userCode: userCode,
+		request:  request,
+		expires:  st.now().Add(st.ttl),
+		done:     make(chan struct{}),
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.prune()
+	if len(st.sessions) >= maxPendingSessions {
+		return nil, errTooManySessions
+	}
+	st.sessions[id] = sess
+
+	return sess, nil
+}
+
+// get returns the session if it's still waiting on the user to log in
+func (st *sessionStore) get(id string) (*loginSession, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, err := st.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.started {
+		return nil, errSessionUsed
+	}
+	return sess, nil
+}
+
+// confirm checks the user code entered in the browser against the session's.
+// After too many wrong codes the session is thrown away, so the code can't be
+// guessed.
+func (st *sessionStore) confirm(id, userCode string) (*loginSession, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, err := st.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.started {
+		return nil, errSessionUsed
+	}
+
+	if subtle.ConstantTimeCompare([]byte(normalizeUserCode(userCode)), []byte(normalizeUserCode(sess.userCode))) != 1 {
+		sess.attempts++
+		if sess.attempts >= maxUserCodeAttempts {
+			delete(st.sessions, id)
+			return nil, errSessionNotFound
+		}
+		return nil, errWrongUserCode
+	}
+
+	sess.confirmed = true
+	return sess, nil
+}
+
+// begin claims the session for a callback. Only the first callback gets it,
+// and only once the user code's been confirmed.
+func (st *sessionStore) begin(id string) (*loginSession, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, err := st.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.started {
+		return nil, errSessionUsed
+	}
+	if !sess.confirmed {
+		return nil, errNotConfirmed
+	}
+
+	sess.started = true
+	return sess, nil
+}
+
+// complete records the result of the login for the CLI to pick up
+func (st *sessionStore) complete(sess *loginSession, response *handlers.CredentialHandlerResponse, errResp *handlers.ErrorResponse, status int) {
+	st.mu.Lock()
+	sess.response = response
+	sess.errResp = errResp
+	sess.status = status
+	st.mu.Unlock()
+
+	close(sess.done)
+}
+
+// pickup waits up to wait for the session to complete and hands it over,
+// deleting it so the result can only be picked up once. A nil session with
+// no error means it's still pending.
+func (st *sessionStore) pickup(id, secret string, wait time.Duration, cancel <-chan struct{}) (*loginSession, error) {
+	st.mu.Lock()
+	sess, err := st.lookup(id)
+	st.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't let on that the session exists to anyone without the secret
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(sess.secret)) != 1 {
+		return nil, errSessionNotFound
+	}
+
+	select {
+	case <-sess.done:
+	case <-time.After(wait):
+		return nil, nil
+	case <-cancel:
+		return nil, nil
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Someone else may have beaten us to it
+	if _, ok := st.sessions[id]; !ok {
+		return nil, errSessionNotFound
+	}
+	delete(st.sessions, id)
+
+	return sess, nil
+}
+
+// lookup finds a live session. Must be called with the lock held.
+func (st *sessionStore) lookup(id string) (*loginSession, error) {
+	sess, ok := st.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+
+	if !st.now().Before(sess.expires) {
+		delete(st.sessions, id)
+		return nil, errSessionExpired
+	}
+
+	return sess, nil
+}
+
+// prune drops expired sessions. Must be called with the lock held.
+func (st *sessionStore) prune() {
+	now := st.now()
+	for id, sess := range st.sessions {
+		if !now.Before(sess.expires) {
+			delete(st.sessions, id)
+		}
+	}
+}
+
+// newUserCode generates a code like BCDF-GHJK
+func newUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	b := make([]byte, 1)
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		// Skip the bytes that would make some characters more likely than
+		// others
+		if int(b[0]) >= 256-256%len(userCodeCharset) {
+			continue
+		}
+		code = append(code, userCodeCharset[int(b[0])%len(userCodeCharset)])
+	}
+	return string(code[:userCodeLength/2]) + "-" + string(code[userCodeLength/2:]), nil
+}
+
+// normalizeUserCode lets the user type the code without the dash, in any
+// case
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/shared/handlers"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestSessionStore(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := newSessionStore(time.Minute)
+	st.now = func() time.Time { return now }
+
+	sess, err := st.create(&handlers.CredentialHandlerRequest{Role: "admin"})
+	if err != nil {
+		t.Fatalf("Expected no error creating session, got %v", err)
+	}
+	if sess.id == "" || sess.secret == "" || sess.id == sess.secret {
+		t.Fatalf("Expected distinct ID and secret, got %q and %q", sess.id, sess.secret)
+	}
+
+	if _, err := st.get(sess.id); err != nil {
+		t.Errorf("Expected pending session, got %v", err)
+	}
+	if _, err := st.get("nope"); err != errSessionNotFound {
+		t.Errorf("Expected %v, got %v", errSessionNotFound, err)
+	}
+
+	// Still pending
+	if got, err := st.pickup(sess.id, sess.secret, time.Millisecond, nil); got != nil || err != nil {
+		t.Errorf("Expected pending pickup, got %v, %v", got, err)
+	}
+	// The secret has to match
+	if _, err := st.pickup(sess.id, "wrong", time.Millisecond, nil); err != errSessionNotFound {
+		t.Errorf("Expected %v for wrong secret, got %v", errSessionNotFound, err)
+	}
+
+	// Nothing starts until the user code's been entered
+	if _, err := st.begin(sess.id); err != errNotConfirmed {
+		t.Errorf("Expected %v, got %v", errNotConfirmed, err)
+	}
+	if _, err := st.confirm(sess.id, "BBBB-BBBB"); err != errWrongUserCode {
+		t.Errorf("Expected %v, got %v", errWrongUserCode, err)
+	}
+	if _, err := st.confirm(sess.id, sess.userCode); err != nil {
+		t.Fatalf("Expected to confirm session, got %v", err)
+	}
+
+	// Only one callback gets the session
+	if _, err := st.begin(sess.id); err != nil {
+		t.Fatalf("Expected to begin session, got %v", err)
+	}
+	if _, err := st.begin(sess.id); err != errSessionUsed {
+		t.Errorf("Expected %v, got %v", errSessionUsed, err)
+	}
+	if _, err := st.get(sess.id); err != errSessionUsed {
+		t.Errorf("Expected %v, got %v", errSessionUsed, err)
+	}
+
+	response := &handlers.CredentialHandlerResponse{Version: 1}
+	st.complete(sess, response, nil, http.StatusOK)
+
+	got, err := st.pickup(sess.id, sess.secret, time.Second, nil)
+	if err != nil || got == nil || got.response != response {
+		t.Fatalf("Expected completed session, got %v, %v", got, err)
+	}
+
+	// Credentials can only be picked up once
+	if _, err := st.pickup(sess.id, sess.secret, time.Millisecond, nil); err != errSessionNotFound {
+		t.Errorf("Expected %v on second pickup, got %v", errSessionNotFound, err)
+	}
+
+	expiring, _ := st.create(&handlers.CredentialHandlerRequest{})
+	now = now.Add(time.Minute)
+	if _, err := st.get(expiring.id); err != errSessionExpired {
+		t.Errorf("Expected %v, got %v", errSessionExpired, err)
+	}
+	if _, err := st.get(expiring.id); err != errSessionNotFound {
+		t.Errorf("Expected expired session to be gone, got %v", err)
+	}
+}
+
+func TestSessionStoreUserCode(t *testing.T) {
+	st := newSessionStore(time.Minute)
+
+	sess, _ := st.create(&handlers.CredentialHandlerRequest{})
+	if len(sess.userCode) != userCodeLength+1 || strings.Trim(sess.userCode, userCodeCharset+"-") != "" {
+		t.Errorf("Expected a code like BCDF-GHJK, got %q", sess.userCode)
+	}
+
+	// Guessing the code throws the session away
+	for i := 1; i < maxUserCodeAttempts; i++ {
+		if _, err := st.confirm(sess.id, "wrong"); err != errWrongUserCode {
+			t.Errorf("[%d] - Expected %v, got %v", i, errWrongUserCode, err)
+		}
+	}
+	if _, err := st.confirm(sess.id, "wrong"); err != errSessionNotFound {
+		t.Errorf("Expected %v, got %v", errSessionNotFound, err)
+	}
+	if _, err := st.confirm(sess.id, sess.userCode); err != errSessionNotFound {
+		t.Errorf("Expected the session to be gone, got %v", err)
+	}
+}
+
+func TestSessionStoreLimit(t *testing.T) {
+	st := newSessionStore(time.Minute)
+
+	for i := 0; i < maxPendingSessions; i++ {
+		if _, err := st.create(&handlers.CredentialHandlerRequest{}); err != nil {
+			t.Fatalf("[%d] - Expected no error, got %v", i, err)
+		}
+	}
+	if _, err := st.create(&handlers.CredentialHandlerRequest{}); err != errTooManySessions {
+		t.Errorf("Expected %v, got %v", errTooManySessions, err)
+	}
+}
+
+func TestSessionHandlerRateLimit(t *testing.T) {
+	s := &Server{
+		logger:         zap.NewNop(),
+		sessions:       newSessionStore(time.Minute),
+		sessionLimiter: newRateLimiter(2, time.Minute),
+	}
+
+	testCases := []struct {
+		remote         string
+		expectedStatus int
+	}{
+		{remote: "10.0.0.1:1234", expectedStatus: http.StatusCreated},
+		{remote: "10.0.0.1:1235", expectedStatus: http.StatusCreated},
+		{remote: "10.0.0.1:1236", expectedStatus: http.StatusTooManyRequests},
+		{remote: "10.0.0.2:1234", expectedStatus: http.StatusCreated},
+	}
+
+	for i, tc := range testCases {
+		req := httptest.NewRequest("POST", "/auth/sessions", strings.NewReader("{}"))
+		req.RemoteAddr = tc.remote
+		w := httptest.NewRecorder()
+		s.SessionHandler(w, req)
+
+		if w.Code != tc.expectedStatus {
+			t.Errorf("[%d] - Expected status %d, got %d", i, tc.expectedStatus, w.Code)
+		}
+	}
+}
+
+func TestPickupHandler(t *testing.T) {
+	s := &Server{
+		logger:   zap.NewNop(),
+		sessions: newSessionStore(time.Minute),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/sessions/{id}/credentials", s.PickupHandler)
+
+	failed, _ := s.sessions.create(&handlers.CredentialHandlerRequest{})
+	s.sessions.begin(failed.id)
+	s.sessions.complete(failed, nil, &handlers.ErrorResponse{Code: handlers.ErrorCodeRoleNotEntitled}, http.StatusForbidden)
+
+	succeeded, _ := s.sessions.create(&handlers.CredentialHandlerRequest{})
+	s.sessions.begin(succeeded.id)
+	s.sessions.complete(succeeded, &handlers.CredentialHandlerResponse{Version: 1}, nil, http.StatusOK)
+
+	testCases := []struct {
+		id             string
+		secret         string
+		expectedStatus int
+	}{
+		{id: succeeded.id, secret: succeeded.secret, expectedStatus: http.StatusOK},
+		// Already picked up
+		{id: succeeded.id, secret: succeeded.secret, expectedStatus: http.StatusNotFound},
+		{id: failed.id, secret: failed.secret, expectedStatus: http.StatusForbidden},
+		{id: "nope", secret: "nope", expectedStatus: http.StatusNotFound},
+	}
+
+	for i, testCase := range testCases {
+		req := httptest.NewRequest("GET", "/auth/sessions/"+testCase.id+"/credentials", nil)
+		req.Header.Set("Authorization", "Bearer "+testCase.secret)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != testCase.expectedStatus {
+			t.Errorf("[%d] - Expected status %d, got %d", i, testCase.expectedStatus, w.Code)
+		}
+	}
+}
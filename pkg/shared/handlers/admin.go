@@ -0,0 +1,9 @@
+package handlers
+
+// InvalidateUserResponse is returned when a user is dropped from the
+// server's directory cache
+type InvalidateUserResponse struct {
+	Email string `json:"email"`
+	// Whether the user was cached
+	Invalidated bool `json:"invalidated"`
+}
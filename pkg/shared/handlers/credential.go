@@ -1,12 +1,66 @@
 package handlers
 
+import "time"
+
+const (
+	// CredentialResponseVersion is the current version of the credential
+	// response. Requests without a version get the legacy response.
+	CredentialResponseVersion = 1
+)
+
 // CredentialHandlerRequest wraps in a credential
 type CredentialHandlerRequest struct {
-	CredentialFile []byte `json:"credential_file"`
+	// Version of the response the client understands
+	Version int `json:"version,omitempty"`
+	// Deprecated: the caller's gcloud credentials file. Clients now send an
+	// ID token in the Authorization header instead.
+	CredentialFile []byte `json:"credential_file,omitempty"`
+	// ARN or alias of the role to assume. Can be left empty if the user only
+	// has the one role.
+	Role string `json:"role,omitempty"`
+	// Asks for credentials that expire sooner than the server would otherwise
+	// grant. Zero takes whatever the server grants.
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
 }
 
 // CredentialHandlerResponse returns a credential response
 type CredentialHandlerResponse struct {
-	CredentialFilePath string `json:"credential_file_path"`
-	CredentialFile     []byte `json:"credential_file"`
+	Version     int          `json:"version,omitempty"`
+	Credentials *Credentials `json:"credentials,omitempty"`
+	// How long the credentials were granted for, and where that duration came from
+	DurationSeconds int64  `json:"duration_seconds"`
+	DurationReason  string `json:"duration_reason"`
+
+	// Deprecated: the credentials rendered as an INI file, only sent to
+	// clients that don't send a version
+	CredentialFile []byte `json:"credential_file,omitempty"`
 }
+
+// Credentials is a set of temporary AWS credentials
+type Credentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+	Region          string    `json:"region,omitempty"`
+	// ARN of the assumed role session
+	RoleARN   string `json:"role_arn,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+}
+
+// Reasons a session duration was granted
+const (
+	// No duration was set for the user, so the server default was used
+	DurationReasonDefault = "default"
+	// The duration set on the user in the directory was used
+	DurationReasonDirectory = "directory"
+	// The client asked for a shorter duration
+	DurationReasonRequested = "requested"
+	// Clamped to the maximum configured for the role
+	DurationReasonRoleMaximum = "role_maximum"
+	// Clamped to the maximum configured for the server
+	DurationReasonServerMaximum = "server_maximum"
+	// Clamped to what STS allows
+	DurationReasonSTSMinimum = "sts_minimum"
+	DurationReasonSTSMaximum = "sts_maximum"
+)
@@ -0,0 +1,28 @@
+package handlers
+
+// Error codes returned to the client when a request is refused
+const (
+	ErrorCodeHostedDomainNotAllowed = "hosted_domain_not_allowed"
+	ErrorCodeAudienceNotAllowed     = "audience_not_allowed"
+	ErrorCodeEmailNotVerified       = "email_not_verified"
+	ErrorCodeRoleNotEntitled        = "role_not_entitled"
+	ErrorCodeRoleAmbiguous          = "role_ambiguous"
+	ErrorCodeRoleRequired           = "role_required"
+	ErrorCodeAssumeRoleFailed       = "assume_role_failed"
+	ErrorCodeUserNotFound           = "user_not_found"
+	ErrorCodeSessionNotFound        = "session_not_found"
+	ErrorCodeSessionExpired         = "session_expired"
+	ErrorCodeTooManySessions        = "too_many_sessions"
+	ErrorCodeRoleDenied             = "role_denied"
+	ErrorCodeCacheDisabled          = "cache_disabled"
+	ErrorCodeUserSuspended          = "user_suspended"
+	ErrorCodeUserArchived           = "user_archived"
+	ErrorCodeUser2SVRequired        = "user_2sv_required"
+)
+
+// ErrorResponse is returned by the server when a request fails with a reason
+// the client should be able to show the user
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,12 @@
+package handlers
+
+// ProviderResponse tells the client how to log into the identity provider
+// on its own
+type ProviderResponse struct {
+	AuthURL       string   `json:"auth_url"`
+	TokenURL      string   `json:"token_url"`
+	DeviceAuthURL string   `json:"device_auth_url,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	ClientSecret  string   `json:"client_secret,omitempty"`
+	Scopes        []string `json:"scopes"`
+}
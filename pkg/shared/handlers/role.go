@@ -0,0 +1,14 @@
+package handlers
+
+// RolesHandlerResponse lists the roles a user is entitled to. The request is
+// the same CredentialHandlerRequest the credential handler takes.
+type RolesHandlerResponse struct {
+	Roles []Role `json:"roles"`
+}
+
+// Role is a role the user can request credentials for
+type Role struct {
+	ARN         string `json:"arn"`
+	Alias       string `json:"alias"`
+	ProviderARN string `json:"provider_arn"`
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import "time"
+
+// SessionResponse is returned when the client starts a browser login. The
+// user logs in at the server's /auth/login?session=<ID>, and the client
+// picks up the credentials with the secret once they're done. The client
+// shows the user code, which the user has to enter in the browser.
+type SessionResponse struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	UserCode  string    `json:"user_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
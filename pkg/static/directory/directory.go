@@ -0,0 +1,136 @@
+package directory
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPathNotSet   = errors.New("directory file path must be set")
+	ErrUserNotFound = directory.ErrUserNotFound
+	ErrRoleNotSet   = errors.New("no roles assigned to the user")
+)
+
+// Client is a directory.Service backed by a YAML file, for local development
+// and deployments too small for a GSuite service account. The file is
+// reloaded when it changes.
+type Client struct {
+	path           string
+	reloadInterval time.Duration
+	logger         *zap.Logger
+
+	mu      sync.RWMutex
+	users   map[string]*directory.User
+	modTime time.Time
+	size    int64
+}
+
+// NewClient creates a Client, loading the directory file up front
+func NewClient(setOpts ...Option) (*Client, error) {
+	opts := defaultOptions()
+	for _, setOpt := range setOpts {
+		setOpt(opts)
+	}
+
+	if opts.Path == "" {
+		return nil, ErrPathNotSet
+	}
+
+	c := &Client{
+		path:           opts.Path,
+		reloadInterval: opts.ReloadInterval,
+		logger:         opts.Logger,
+	}
+
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetUser finds a user by email
+func (c *Client) GetUser(email string) (*directory.User, error) {
+	c.mu.RLock()
+	user, ok := c.users[strings.ToLower(email)]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	if len(user.Roles) == 0 {
+		c.logger.Error("error no roles assigned to user", zap.String("email", email))
+		return nil, ErrRoleNotSet
+	}
+
+	// Callers get their own copy to do with as they please
+	return user.Copy(), nil
+}
+
+// Reload loads the directory file if it's changed since it was last loaded,
+// returning whether it was. If the file doesn't validate, the users that
+// were already loaded are kept.
+func (c *Client) Reload() (bool, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.users != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	raw, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return false, err
+	}
+
+	users, err := parse(raw)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.users = users
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	c.mu.Unlock()
+
+	return true, nil
+}
+
+// Run checks the file for changes until stop is closed. It returns right
+// away if the reload interval isn't positive, which turns reloading off.
+func (c *Client) Run(stop <-chan struct{}) {
+	if c.reloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				c.logger.Error("error reloading directory file, keeping the last good one", zap.String("path", c.path), zap.Error(err))
+			} else if reloaded {
+				c.logger.Info("reloaded directory file", zap.String("path", c.path))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package directory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s\n", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "directory.yaml")
+	if err := ioutil.WriteFile(path, []byte(validFile), 0600); err != nil {
+		t.Fatalf("Error writing file: %s\n", err.Error())
+	}
+
+	c, err := NewClient(WithPath(path), WithLogger(zap.NewNop()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	user, err := c.GetUser("alice@EXAMPLE.com")
+	if err != nil || len(user.Roles) != 2 {
+		t.Fatalf("Expected alice with two roles, got %+v, %v", user, err)
+	}
+
+	if _, err := c.GetUser("carol@example.com"); err != ErrUserNotFound {
+		t.Errorf("Expected %v, got %v", ErrUserNotFound, err)
+	}
+
+	// Broken files are refused, and the last good one is kept
+	writeLater(t, path, "users: [")
+	if reloaded, err := c.Reload(); reloaded || err == nil {
+		t.Errorf("Expected invalid file to be refused, got %t, %v", reloaded, err)
+	}
+	if _, err := c.GetUser("alice@example.com"); err != nil {
+		t.Errorf("Expected alice to still be there, got %v", err)
+	}
+
+	writeLater(t, path, `
+roles:
+  admin:
+    arn: arn:aws:iam::111111111111:role/admin
+    provider_arn: arn:aws:iam::111111111111:saml-provider/GSuite
+users:
+  - email: carol@example.com
+    roles: [admin]
+  - email: dave@example.com
+`)
+	if reloaded, err := c.Reload(); !reloaded || err != nil {
+		t.Fatalf("Expected file to be reloaded, got %t, %v", reloaded, err)
+	}
+	if _, err := c.GetUser("alice@example.com"); err != ErrUserNotFound {
+		t.Errorf("Expected alice to be gone, got %v", err)
+	}
+	if _, err := c.GetUser("carol@example.com"); err != nil {
+		t.Errorf("Expected carol, got %v", err)
+	}
+	if _, err := c.GetUser("dave@example.com"); err != ErrRoleNotSet {
+		t.Errorf("Expected %v, got %v", ErrRoleNotSet, err)
+	}
+
+	// Nothing to do when the file hasn't changed
+	if reloaded, err := c.Reload(); reloaded || err != nil {
+		t.Errorf("Expected no reload, got %t, %v", reloaded, err)
+	}
+}
+
+// writeLater writes the file with a newer modification time, so the change
+// is seen even on filesystems with coarse timestamps
+func writeLater(t *testing.T, path, contents string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading file: %s\n", err.Error())
+	}
+
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("Error writing file: %s\n", err.Error())
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Error touching file: %s\n", err.Error())
+	}
+}
+
+func TestRunDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s\n", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "directory.yaml")
+	if err := ioutil.WriteFile(path, []byte(validFile), 0600); err != nil {
+		t.Fatalf("Error writing file: %s\n", err.Error())
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		c, err := NewClient(WithPath(path), WithLogger(zap.NewNop()), WithReloadInterval(interval))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Without reloading there's nothing to wait for, so Run is done
+		// before stop is ever closed
+		done := make(chan struct{})
+		go func() {
+			c.Run(make(chan struct{}))
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("Expected Run to return with a reload interval of %v", interval)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package directory
+
+import (
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Options contains all Client options
+type Options struct {
+	Logger *zap.Logger
+	// Path to the directory file
+	Path string
+	// How often to check the file for changes
+	ReloadInterval time.Duration
+}
+
+// Option is a functional way of setting options for the Client
+type Option func(o *Options)
+
+// WithLogger sets the logger on the Options struct
+func WithLogger(l *zap.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithPath sets the path to the directory file
+func WithPath(path string) Option {
+	return func(o *Options) {
+		o.Path = path
+	}
+}
+
+// WithReloadInterval sets how often the file is checked for changes. Zero or
+// less turns reloading off.
+func WithReloadInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.ReloadInterval = d
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Logger:         logging.Logger(),
+		ReloadInterval: 10 * time.Second,
+	}
+}
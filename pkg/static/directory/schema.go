@@ -0,0 +1,134 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	ErrEmailNotSet = errors.New("user email must be set")
+)
+
+// file is the layout of the directory file. Roles are defined once by name,
+// and assigned to users directly or through their groups.
+//
+//	roles:
+//	  admin:
+//	    arn: arn:aws:iam::111111111111:role/admin
+//	    provider_arn: arn:aws:iam::111111111111:saml-provider/GSuite
+//	groups:
+//	  ops:
+//	    roles: [admin]
+//	users:
+//	  - email: alice@example.com
+//	    groups: [ops]
+//	    session_duration: 2h
+//	    attributes:
+//	      department: Engineering
+type file struct {
+	Roles  map[string]fileRole  `yaml:"roles"`
+	Groups map[string]fileGroup `yaml:"groups"`
+	Users  []fileUser           `yaml:"users"`
+}
+
+type fileRole struct {
+	ARN         string `yaml:"arn"`
+	ProviderARN string `yaml:"provider_arn"`
+}
+
+type fileGroup struct {
+	Roles []string `yaml:"roles"`
+}
+
+type fileUser struct {
+	Email           string            `yaml:"email"`
+	Groups          []string          `yaml:"groups"`
+	Roles           []string          `yaml:"roles"`
+	SessionDuration time.Duration     `yaml:"session_duration"`
+	Attributes      map[string]string `yaml:"attributes"`
+}
+
+// parse loads and validates the directory file, returning its users keyed
+// by lowercased email. Any mistake in the file fails the whole thing, so a
+// typo can't quietly take roles away from people.
+func parse(raw []byte) (map[string]*directory.User, error) {
+	f := &file{}
+	if err := yaml.UnmarshalStrict(raw, f); err != nil {
+		return nil, err
+	}
+
+	roles := map[string]directory.Role{}
+	for name, r := range f.Roles {
+		role, err := directory.ParseRole(r.ARN + "," + r.ProviderARN)
+		if err != nil {
+			return nil, fmt.Errorf("role %q: %s", name, err)
+		}
+		roles[name] = role
+	}
+
+	for name, group := range f.Groups {
+		for _, role := range group.Roles {
+			if _, ok := roles[role]; !ok {
+				return nil, fmt.Errorf("group %q: unknown role %q", name, role)
+			}
+		}
+	}
+
+	users := map[string]*directory.User{}
+	for i, u := range f.Users {
+		if u.Email == "" {
+			return nil, fmt.Errorf("user %d: %s", i, ErrEmailNotSet)
+		}
+
+		key := strings.ToLower(u.Email)
+		if _, ok := users[key]; ok {
+			return nil, fmt.Errorf("user %q: duplicate email", u.Email)
+		}
+
+		if u.SessionDuration < 0 {
+			return nil, fmt.Errorf("user %q: session duration can't be negative", u.Email)
+		}
+
+		user := &directory.User{
+			Email:           u.Email,
+			Groups:          u.Groups,
+			SessionDuration: u.SessionDuration,
+			Attributes:      u.Attributes,
+		}
+
+		// Roles from groups and the user can overlap, only list each once
+		seen := map[string]bool{}
+		assign := func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				user.Roles = append(user.Roles, roles[name])
+			}
+		}
+
+		for _, groupName := range u.Groups {
+			group, ok := f.Groups[groupName]
+			if !ok {
+				return nil, fmt.Errorf("user %q: unknown group %q", u.Email, groupName)
+			}
+			for _, role := range group.Roles {
+				assign(role)
+			}
+		}
+
+		for _, role := range u.Roles {
+			if _, ok := roles[role]; !ok {
+				return nil, fmt.Errorf("user %q: unknown role %q", u.Email, role)
+			}
+			assign(role)
+		}
+
+		users[key] = user
+	}
+
+	return users, nil
+}
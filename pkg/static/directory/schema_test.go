@@ -0,0 +1,116 @@
+package directory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/catherinetcai/gsuite-aws-sso/pkg/directory"
+)
+
+const validFile = `
+roles:
+  admin:
+    arn: arn:aws:iam::111111111111:role/admin
+    provider_arn: arn:aws:iam::111111111111:saml-provider/GSuite
+  readonly:
+    arn: arn:aws:iam::111111111111:role/readonly
+    provider_arn: arn:aws:iam::111111111111:saml-provider/GSuite
+groups:
+  ops:
+    roles: [admin, readonly]
+users:
+  - email: Alice@example.com
+    groups: [ops]
+    roles: [readonly]
+    session_duration: 2h
+    attributes:
+      department: Engineering
+  - email: bob@example.com
+    roles: [readonly]
+`
+
+func TestParse(t *testing.T) {
+	users, err := parse([]byte(validFile))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	admin := directory.Role{ARN: "arn:aws:iam::111111111111:role/admin", ProviderARN: "arn:aws:iam::111111111111:saml-provider/GSuite"}
+	readonly := directory.Role{ARN: "arn:aws:iam::111111111111:role/readonly", ProviderARN: "arn:aws:iam::111111111111:saml-provider/GSuite"}
+
+	expected := map[string]*directory.User{
+		"alice@example.com": {
+			Email:           "Alice@example.com",
+			Roles:           []directory.Role{admin, readonly},
+			Groups:          []string{"ops"},
+			SessionDuration: 2 * time.Hour,
+			Attributes:      map[string]string{"department": "Engineering"},
+		},
+		"bob@example.com": {
+			Email: "bob@example.com",
+			Roles: []directory.Role{readonly},
+		},
+	}
+
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, users)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []string{
+		// Duplicate emails, whatever their case
+		`
+users:
+  - email: alice@example.com
+  - email: ALICE@example.com
+`,
+		// Not a role ARN
+		`
+roles:
+  admin:
+    arn: admin
+    provider_arn: arn:aws:iam::111111111111:saml-provider/GSuite
+`,
+		// Missing the provider
+		`
+roles:
+  admin:
+    arn: arn:aws:iam::111111111111:role/admin
+`,
+		// Unknown references
+		`
+groups:
+  ops:
+    roles: [admin]
+`,
+		`
+users:
+  - email: alice@example.com
+    groups: [ops]
+`,
+		`
+users:
+  - email: alice@example.com
+    roles: [admin]
+`,
+		// Missing email
+		`
+users:
+  - roles: []
+`,
+		// Typos in field names
+		`
+users:
+  - email: alice@example.com
+    group: [ops]
+`,
+	}
+
+	for i, testCase := range testCases {
+		if _, err := parse([]byte(testCase)); err == nil {
+			t.Errorf("[%d] - Expected error, got none", i)
+		}
+	}
+}